@@ -24,11 +24,14 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/iTrellis/trellis/configure"
+	"github.com/iTrellis/trellis/internal/tracing"
 	"github.com/iTrellis/trellis/routes"
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
 	"github.com/iTrellis/trellis/service/registry"
 	"github.com/iTrellis/trellis/version"
 
@@ -49,6 +52,13 @@ type Cmd interface {
 
 	App() *cli.App
 
+	// Config the project's config, nil before Init with config
+	Config() config.Config
+	// Logger the logger initialized by the project's config
+	Logger() logger.Logger
+	// Caller call the components through the middlewares, the same as the servers do
+	Caller() message.Caller
+
 	service.LifeCycle
 
 	BlockRun() error
@@ -65,6 +75,8 @@ type cmd struct {
 
 	registries map[string]registry.Registry
 
+	shutdownTracing tracing.ShutdownFunc
+
 	logger logger.Logger
 }
 
@@ -72,11 +84,22 @@ func (p *cmd) Options() Options {
 	return p.options
 }
 
-func (p *cmd) Start() error {
+func (p *cmd) Start() (err error) {
 	if p.config == nil {
 		return nil
 	}
 
+	p.shutdownTracing, err = tracing.Init(p.config.GetValuesConfig("project.tracing"))
+	if err != nil {
+		return err
+	}
+
+	mws, err := getMiddlewares(p.config.GetStringList("project.middlewares"))
+	if err != nil {
+		return err
+	}
+	p.routesManager.Use(mws...)
+
 	registriesConfig := p.config.GetValuesConfig("project.registries")
 
 	for _, rKey := range registriesConfig.GetKeys() {
@@ -95,6 +118,7 @@ func (p *cmd) Start() error {
 		opts := []registry.Option{}
 
 		opts = append(opts,
+			registry.Name(rKey),
 			registry.Endpoints(regConfig.Endpoints),
 			registry.ServerAddr(regConfig.ServerAddr),
 			registry.Timeout(regConfig.Timeout),
@@ -114,7 +138,8 @@ func (p *cmd) Start() error {
 
 		p.registries[rKey] = reg
 
-		for _, w := range regConfig.Watchers {
+		for i := range regConfig.Watchers {
+			w := &regConfig.Watchers[i]
 			p.logger.Debug("new_registry_watcher", "name", regConfig.Name, "address", regConfig.ServerAddr,
 				"watch_service", w.Service.FullRegistryPath())
 			rCpt, err := routes.NewRemoteComponent(node.NodeTypeRandom, reg,
@@ -126,13 +151,26 @@ func (p *cmd) Start() error {
 				return err
 			}
 
-			rCpt.Init(component.Caller(p.routesManager),
+			rOpts := []component.Option{
+				component.Caller(p.routesManager),
+				component.CompManager(p.routesManager.CompManager()),
 				component.Config(w.Options.ToConfig()),
-				component.Logger(p.logger.With("remote_component", w.Service.TrellisPath())))
+				component.Logger(p.logger.With("remote_component", w.Service.TrellisPath())),
+				component.ConfigSource(fmt.Sprintf("project.registries.%s.watchers.%d", rKey, i)),
+				component.Registry(rKey),
+			}
 
-			if err = p.routesManager.CompManager().RegisterComponent(&w.Service, rCpt); err != nil {
+			rCpt.Init(rOpts...)
+
+			if err = p.routesManager.CompManager().RegisterComponent(&w.Service, rCpt, rOpts...); err != nil {
+				return err
+			}
+
+			wMws, err := getMiddlewares(w.Middlewares)
+			if err != nil {
 				return err
 			}
+			p.routesManager.UseService(&w.Service, append(getConcurrencyMiddlewares(w.Concurrency), wMws...)...)
 		}
 	}
 
@@ -146,17 +184,46 @@ func (p *cmd) Start() error {
 			return err
 		}
 
-		p.logger.Debug("new_component", "component", serviceConf.Service.TrellisPath())
+		var deps []*service.Service
+		for i := range serviceConf.DependsOn {
+			deps = append(deps, &serviceConf.DependsOn[i])
+		}
+
+		instance := serviceConf.Instance
+		if instance == "" {
+			instance = serviceConf.Service.TrellisPath()
+		}
+
+		p.logger.Debug("new_component", "component", serviceConf.Service.TrellisPath(), "instance", instance)
 		if _, err := p.routesManager.CompManager().NewComponent(
 			&serviceConf.Service,
+			component.Instance(instance),
 			component.Caller(p.routesManager),
+			component.CompManager(p.routesManager.CompManager()),
 			component.Config(serviceConf.Options.ToConfig()),
-			component.Logger(p.logger.With("component", serviceConf.Service.TrellisPath())),
+			component.Logger(p.logger.With("component", serviceConf.Service.TrellisPath(), "instance", instance)),
+			component.Dependencies(deps...),
+			component.StartTimeout(serviceConf.StartTimeout),
+			component.StopTimeout(serviceConf.StopTimeout),
+			component.ConfigSource("project.services."+sKey),
+			component.Registry(serviceConf.Registry.GetName()),
+			component.ProjectConfig(p.config),
 		); err != nil {
-			p.logger.Error("new_component", "component", serviceConf.Service.TrellisPath(), "err", err.Error())
+			p.logger.Error("new_component", "component", serviceConf.Service.TrellisPath(),
+				"instance", instance, "err", err.Error())
 			return err
 		}
 
+		// middlewares, concurrency limiter and registry are applied to the instance's own identity
+		identity := component.InstanceService(&serviceConf.Service, instance)
+
+		sMws, err := getMiddlewares(serviceConf.Middlewares)
+		if err != nil {
+			return err
+		}
+		p.routesManager.UseService(identity,
+			append(getConcurrencyMiddlewares(serviceConf.Concurrency), sMws...)...)
+
 		if serviceConf.Registry == nil {
 			continue
 		}
@@ -176,7 +243,7 @@ func (p *cmd) Start() error {
 			return fmt.Errorf("not found registry: %s", serviceConf.Registry.Name)
 		}
 
-		err := reg.Register(&serviceConf.Service, opts...)
+		err = reg.Register(identity, opts...)
 
 		if err != nil {
 			return err
@@ -264,6 +331,14 @@ func (p *cmd) Stop() error {
 	if err := p.routesManager.Stop(); err != nil {
 		return err
 	}
+
+	if p.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.shutdownTracing(ctx); err != nil {
+			p.logger.Warn("failed_shutdown_tracing", "err", err.Error())
+		}
+	}
 	return nil
 }
 
@@ -292,6 +367,18 @@ func (p *cmd) App() *cli.App {
 	return p.app
 }
 
+func (p *cmd) Config() config.Config {
+	return p.config
+}
+
+func (p *cmd) Logger() logger.Logger {
+	return p.logger
+}
+
+func (p *cmd) Caller() message.Caller {
+	return p.routesManager
+}
+
 // New new command interface
 func New(opts ...Option) (Cmd, error) {
 	builder.Show()
@@ -331,7 +418,30 @@ func New(opts ...Option) (Cmd, error) {
 					Usage: "list of local components",
 					Action: func(ctx *cli.Context) error {
 						for _, cpt := range cmd.routesManager.CompManager().ListComponents() {
-							fmt.Printf("components: %s - started: %t\n", cpt.Name, cpt.Started)
+							fmt.Printf("components: %s - started: %t, state: %s, register_func: %s, "+
+								"config_source: %s, registry: %s, remote: %t, uptime: %s\n",
+								cpt.Name, cpt.Started, cpt.State, cpt.RegisterFunc,
+								cpt.ConfigSource, cpt.Registry, cpt.Remote, cpt.Uptime)
+							for _, nd := range cpt.Nodes {
+								fmt.Printf("\tnode: %s - %s, weight: %d\n", nd.ID, nd.Value, nd.Weight)
+							}
+						}
+						return nil
+					},
+				},
+				&cli.Command{
+					Name:  "topics",
+					Usage: "list of local components' topics",
+					Action: func(ctx *cli.Context) error {
+						for _, cpt := range cmd.routesManager.CompManager().ListComponents() {
+							lister, ok := cpt.Component.(component.TopicLister)
+							if !ok {
+								continue
+							}
+							for _, t := range lister.ListTopics() {
+								fmt.Printf("components: %s - topic: %s, request: %s, response: %s\n",
+									cpt.Name, t.Name, t.Request, t.Response)
+							}
 						}
 						return nil
 					},
@@ -374,6 +484,10 @@ func New(opts ...Option) (Cmd, error) {
 		},
 	}
 
+	for _, fn := range DefaultCommands {
+		cmd.app.Commands = append(cmd.app.Commands, fn(cmd))
+	}
+
 	for _, v := range DefaultHiddenVersions {
 		if cmd.app.Version != v {
 			continue
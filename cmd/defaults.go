@@ -18,6 +18,13 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package cmd
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/iTrellis/trellis/configure"
+	"github.com/iTrellis/trellis/internal/ratelimit"
 	"github.com/iTrellis/trellis/routes"
 	"github.com/iTrellis/trellis/sd/etcd"
 	"github.com/iTrellis/trellis/sd/memory"
@@ -38,9 +45,61 @@ var (
 
 	// DefaultCompManager default components manager
 	DefaultCompManager = routes.NewCompManager()
+
+	// DefaultMiddlewares middlewares could be used in configure by name, the built-in ones are:
+	// logging: log the calls, recovery: convert the panics into errors, metrics: observe the in-flight calls
+	DefaultMiddlewares = map[string]component.Middleware{
+		"logging":  routes.Logging(),
+		"recovery": routes.Recovery(),
+		"metrics":  routes.Metrics(),
+	}
+
+	// DefaultCommands subcommands registered by the packages, which are added into the app by New
+	DefaultCommands []NewCommandFunc
 )
 
+// NewCommandFunc new the subcommand of the cmd, the action could call Init with the config file,
+// then use the config & logger of the cmd
+type NewCommandFunc func(Cmd) *cli.Command
+
+// RegisterCommand regist subcommand into the app
+func RegisterCommand(fn NewCommandFunc) {
+	DefaultCommands = append(DefaultCommands, fn)
+}
+
 // RegisterComponentFunc regist component funciton into default local route
 func RegisterComponentFunc(service *service.Service, fn component.NewComponentFunc) {
 	DefaultCompManager.RegisterComponentFunc(service, fn)
 }
+
+// RegisterMiddleware regist middleware with name, which could be configured in project's yaml
+func RegisterMiddleware(name string, mw component.Middleware) error {
+	if mw == nil {
+		return errors.New("middleware is nil")
+	}
+	if _, ok := DefaultMiddlewares[name]; ok {
+		return fmt.Errorf("middleware (%s) is already exist", name)
+	}
+	DefaultMiddlewares[name] = mw
+	return nil
+}
+
+func getMiddlewares(names []string) ([]component.Middleware, error) {
+	var mws []component.Middleware
+	for _, name := range names {
+		mw, ok := DefaultMiddlewares[name]
+		if !ok {
+			return nil, fmt.Errorf("not found middleware: %s", name)
+		}
+		mws = append(mws, mw)
+	}
+	return mws, nil
+}
+
+// getConcurrencyMiddlewares middlewares of limiting the in-flight calls
+func getConcurrencyMiddlewares(limit *configure.ConcurrencyLimit) []component.Middleware {
+	if limit == nil || limit.MaxInFlight <= 0 {
+		return nil
+	}
+	return []component.Middleware{ratelimit.MaxInFlight(limit.MaxInFlight, limit.QueueTimeout)}
+}
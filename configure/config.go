@@ -17,14 +17,20 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 
 package configure
 
-import "github.com/iTrellis/common/logger"
+import (
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/config"
+)
 
 type Configure struct {
 	Project Project `json:"project" yaml:"project"`
 }
 
 type Project struct {
-	Logger     logger.LogConfig     `json:"logger" yaml:"logger"`
-	Registries map[string]*Registry `json:"registries" yaml:"registries"`
-	Services   map[string]*Service  `json:"services" yaml:"services"`
+	Logger      logger.LogConfig     `json:"logger" yaml:"logger"`
+	Middlewares []string             `json:"middlewares" yaml:"middlewares"`
+	Registries  map[string]*Registry `json:"registries" yaml:"registries"`
+	Services    map[string]*Service  `json:"services" yaml:"services"`
+	// Tracing options of the opentelemetry exporter
+	Tracing config.Options `json:"tracing" yaml:"tracing"`
 }
@@ -43,4 +43,10 @@ type Watcher struct {
 	service.Service `json:",inline" yaml:",inline"`
 
 	Options config.Options `json:"options" yaml:"options"`
+
+	// names of the middlewares wrapping the calls of the remote service
+	Middlewares []string `json:"middlewares" yaml:"middlewares"`
+
+	// limit of the in-flight calls of the remote component
+	Concurrency *ConcurrencyLimit `json:"concurrency" yaml:"concurrency"`
 }
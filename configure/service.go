@@ -28,11 +28,33 @@ import (
 type Service struct {
 	service.Service `json:",inline" yaml:",inline"`
 
+	// instance name of the component, default is the trellis path of the service,
+	// used for running several instances of the same service with different options,
+	// the named instance is called and registered as the service named with the instance name
+	Instance string `json:"instance" yaml:"instance"`
+
 	Options config.Options `json:"options" yaml:"options"`
 
+	// names of the middlewares wrapping the calls of the service
+	Middlewares []string `json:"middlewares" yaml:"middlewares"`
+
+	// components should be started before the service
+	DependsOn    []service.Service `json:"depends_on" yaml:"depends_on"`
+	StartTimeout time.Duration     `json:"start_timeout" yaml:"start_timeout"`
+	StopTimeout  time.Duration     `json:"stop_timeout" yaml:"stop_timeout"`
+
+	// limit of the in-flight calls of the component
+	Concurrency *ConcurrencyLimit `json:"concurrency" yaml:"concurrency"`
+
 	Registry *ServiceRegistry `json:"registry" yaml:"registry"`
 }
 
+// ConcurrencyLimit max in-flight calls of the component, the extra calls are queued until queue timeout
+type ConcurrencyLimit struct {
+	MaxInFlight  int           `json:"max_in_flight" yaml:"max_in_flight"`
+	QueueTimeout time.Duration `json:"queue_timeout" yaml:"queue_timeout"`
+}
+
 // ServiceRegistry service's registry infor
 type ServiceRegistry struct {
 	// registry name
@@ -46,6 +68,14 @@ type ServiceRegistry struct {
 	Heartbeat time.Duration `json:"heartbeat" yaml:"heartbeat"`
 }
 
+// GetName get name of the registry, empty if it is nil
+func (p *ServiceRegistry) GetName() string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
+
 // func (p *Service) ToNode(*Registry) *node.Node {
 // 	n := &node.Node{
 // 		Metadata: p.Options,
@@ -26,29 +26,51 @@ import (
 )
 
 type ping struct {
+	*component.Router
+
 	opts component.Options
 }
 
+// PingRequest request of etcd_ping
+type PingRequest struct {
+	Name string `json:"name"`
+}
+
 func NewPing(opts ...component.Option) (component.Component, error) {
-	c := &ping{}
+	c := &ping{Router: component.NewRouter()}
 	for _, o := range opts {
 		o(&c.opts)
 	}
+
+	if err := c.Handle("ping", c.ping); err != nil {
+		return nil, err
+	}
+
+	if err := c.HandleFunc("etcd_ping", c.etcdPing); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
-func (p *ping) Route(msg message.Message) (interface{}, error) {
-	switch msg.Topic() {
-	case "ping":
-		return p.opts.Caller.CallComponent(message.NewMessage(
-			message.Service(&service.Service{Name: "component_pong", Version: "v1", Topic: "ping"}),
-		))
-	case "etcd_ping":
-		return nil, nil
+func (p *ping) ping(msg message.Message) (interface{}, error) {
+	reqID := msg.GetPayload().Get(service.HeaderXRequestID)
+	if p.opts.Logger != nil {
+		component.MessageLogger(p.opts.Logger, msg).Info("ping", "to", "component_pong")
 	}
-	return nil, fmt.Errorf("unknown topic")
+
+	// forward the request id to the next component
+	payload := &message.Payload{}
+	payload.Set(service.HeaderXRequestID, reqID)
+
+	return p.opts.Caller.CallComponent(message.NewMessage(
+		message.Service(&service.Service{Name: "component_pong", Version: "v1", Topic: "ping"}),
+		message.MessagePayload(payload),
+	))
 }
 
+func (p *ping) etcdPing(req *PingRequest) (string, error) {
+	return fmt.Sprintf("pong %s", req.Name), nil
+}
 func (p *ping) Start() error {
 	println("component ping started")
 	return nil
@@ -22,7 +22,8 @@ import (
 	"log"
 
 	"github.com/iTrellis/trellis/cmd"
-	"github.com/iTrellis/trellis/server/api"
+	_ "github.com/iTrellis/trellis/server/api"
+	"github.com/iTrellis/trellis/server/gateway"
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/component"
 	"github.com/iTrellis/trellis/service/message"
@@ -30,7 +31,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// custom handler
+// custom handler, provided by the component instance listed in http.handlers of the gateway
 // curl -X 'POST' 'http://localhost:8080/ch'
 
 // component handler
@@ -39,7 +40,6 @@ import (
 func init() {
 	cmd.DefaultCompManager.RegisterComponentFunc(
 		&service.Service{Domain: "custom", Name: "component_handler", Version: "v1"}, NewCompHandler)
-	api.RegistCustomHandlers("custom_handler", "ch", "post", customHandler)
 }
 
 func main() {
@@ -57,22 +57,15 @@ func main() {
 	}
 }
 
-var defHandler *compHandler
-
-func customHandler(c *gin.Context) {
-	defHandler.options.Logger.Info("custom_handler")
-	c.JSON(200, map[string]string{"message": defHandler.Response})
-}
-
 func NewCompHandler(opts ...component.Option) (component.Component, error) {
-	defHandler = &compHandler{
+	h := &compHandler{
 		Response: "pong",
 	}
 
 	for _, o := range opts {
-		o(&defHandler.options)
+		o(&h.options)
 	}
-	return defHandler, nil
+	return h, nil
 }
 
 type compHandler struct {
@@ -88,6 +81,17 @@ func (p *compHandler) Route(msg message.Message) (interface{}, error) {
 	return nil, nil
 }
 
+func (p *compHandler) HTTPHandlers() []gateway.Handler {
+	return []gateway.Handler{
+		{Name: "custom_handler", Method: "POST", Path: "/ch", Func: p.customHandler},
+	}
+}
+
+func (p *compHandler) customHandler(c *gin.Context) {
+	p.options.Logger.Info("custom_handler")
+	c.JSON(200, map[string]string{"message": p.Response})
+}
+
 func (p *compHandler) Start() error {
 	fmt.Println("customer handler started")
 	return nil
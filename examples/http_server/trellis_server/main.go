@@ -33,6 +33,8 @@ import (
 
 // curl -X 'POST' -H 'X-Api: trellis.ping' 'http://localhost:8080/v1' -H 'Authorization: aaa'
 
+// curl 'http://localhost:8080/pings/trellis?times=1' -H 'Authorization: aaa'  ## declared route of api
+
 // curl -X 'GET' 'http://localhost:8080/debug/pprof/profile' -H 'Authorization: test'
 
 // curl -i 'http://localhost:8080/' -H 'Authorization: aaa'  ## 302
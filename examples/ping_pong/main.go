@@ -26,6 +26,7 @@ import (
 	"github.com/iTrellis/trellis/cmd"
 	"github.com/iTrellis/trellis/examples/components"
 	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
 )
 
 func main() {
@@ -44,19 +45,24 @@ func main() {
 
 	// implicit in pong.go
 
+	// middleware wrapping every component call by CallComponent
+	cmd.RegisterMiddleware("print", func(next component.Handler) component.Handler {
+		return func(msg message.Message) (interface{}, error) {
+			fmt.Println("call component:", msg.Service().TrellisPath(), "topic:", msg.Topic())
+			return next(msg)
+		}
+	})
+
 	if err := c.Start(); err != nil {
 		log.Fatalln(err)
 	}
 
 	defer c.Stop()
 
-	cpt, err := cmd.DefaultCompManager.GetComponent(&service.Service{Name: "component_ping", Version: "v1"})
-	if err != nil {
-		log.Fatalln(err)
-	}
-	msg := message.NewMessage()
-	msg.SetTopic("ping")
-	resp, err := cpt.Route(msg)
+	// the message is routed through the middlewares, such as print & logging
+	msg := message.NewMessage(
+		message.Service(&service.Service{Name: "component_ping", Version: "v1", Topic: "ping"}))
+	resp, err := c.Caller().CallComponent(msg)
 	if err != nil {
 		log.Fatalln(err)
 	}
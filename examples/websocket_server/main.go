@@ -0,0 +1,124 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/iTrellis/trellis/cmd"
+	"github.com/iTrellis/trellis/server/websocket"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// websocat ws://localhost:8090/ws
+// {"id": "1", "api": "chat.enter", "body": {"room": "lobby"}}
+// {"id": "2", "api": "chat.say", "body": {"room": "lobby", "text": "hello"}}
+
+var wsService = &service.Service{Name: "trellis-server-websocket", Version: "v1"}
+
+func init() {
+	cmd.DefaultCompManager.RegisterComponentFunc(
+		&service.Service{Name: "component_chat", Version: "v1"}, NewChat)
+}
+
+func main() {
+	c, err := cmd.New()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := c.Init(cmd.ConfigFile("config.yaml")); err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := c.BlockRun(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+type chat struct {
+	*component.Router
+
+	options component.Options
+}
+
+type enterRequest struct {
+	Room string `json:"room"`
+}
+
+type sayRequest struct {
+	Room string `json:"room"`
+	Text string `json:"text"`
+}
+
+func NewChat(opts ...component.Option) (component.Component, error) {
+	c := &chat{Router: component.NewRouter()}
+	for _, o := range opts {
+		o(&c.options)
+	}
+
+	if err := c.HandleFunc("enter", c.enter); err != nil {
+		return nil, err
+	}
+	if err := c.HandleFunc("say", c.say); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// enter join the connection into the room
+func (p *chat) enter(msg message.Message, req *enterRequest) (interface{}, error) {
+	return p.call(websocket.TopicJoin, &websocket.GroupRequest{
+		ConnectionID: msg.GetPayload().Get(service.HeaderXConnectionID),
+		Group:        req.Room,
+	})
+}
+
+// say push the text to the connections in the room
+func (p *chat) say(msg message.Message, req *sayRequest) (interface{}, error) {
+	data, err := json.Marshal(map[string]string{
+		"from": msg.GetPayload().Get(service.HeaderXConnectionID),
+		"text": req.Text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.call(websocket.TopicPush, &websocket.PushRequest{Group: req.Room, Event: "said", Data: data})
+}
+
+func (p *chat) call(topic string, req interface{}) (interface{}, error) {
+	s := *wsService
+	s.Topic = topic
+
+	msg := message.NewMessage(message.Service(&s), message.MessagePayload(&message.Payload{}))
+	if err := msg.SetBody(req); err != nil {
+		return nil, err
+	}
+	return p.options.Caller.CallComponent(msg)
+}
+
+func (p *chat) Start() error {
+	return nil
+}
+
+func (p *chat) Stop() error {
+	return nil
+}
@@ -10,16 +10,25 @@ require (
 	github.com/go-resty/resty/v2 v2.6.0
 	github.com/golang/protobuf v1.5.2
 	github.com/google/uuid v1.3.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/iTrellis/common v0.21.14
 	github.com/iTrellis/config v0.21.9
 	github.com/iTrellis/node v0.21.7
 	github.com/iTrellis/xorm_ext v0.21.8
+	github.com/mattn/go-sqlite3 v1.14.8
 	github.com/mitchellh/hashstructure/v2 v2.0.2
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c
+	github.com/prometheus/client_golang v1.11.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/urfave/cli/v2 v2.3.0
 	go.etcd.io/etcd/api/v3 v3.5.0
 	go.etcd.io/etcd/client/v3 v3.5.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
 	go.uber.org/zap v1.19.0
 	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.27.1
 	xorm.io/xorm v1.2.3
 )
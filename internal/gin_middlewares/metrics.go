@@ -0,0 +1,53 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package gin_middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/config"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// LoadMetrics expose prometheus metrics
+func LoadMetrics(engine *gin.Engine, conf config.Config) {
+
+	if conf == nil || engine == nil {
+		return
+	}
+
+	if !conf.GetBoolean("enabled", false) {
+		return
+	}
+
+	handlers := []gin.HandlerFunc{}
+	authorization := conf.GetString("authorization")
+	if authorization != "" {
+		handlers = append(handlers, func(c *gin.Context) {
+			if c.Request.Header.Get("Authorization") != authorization {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+		})
+	}
+	handlers = append(handlers, gin.WrapH(promhttp.Handler()))
+
+	engine.GET(conf.GetString("path", "/metrics"), handlers...)
+}
@@ -30,13 +30,6 @@ import (
 	"github.com/iTrellis/trellis/service"
 )
 
-type Handler struct {
-	Name    string
-	URLPath string
-	Method  string
-	Func    gin.HandlerFunc
-}
-
 var UseFuncs = make(map[string]gin.HandlerFunc)
 var IndexGinFuncs []string
 
@@ -53,7 +46,13 @@ func RegistUseFuncs(name string, fn gin.HandlerFunc) error {
 
 func NewRequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Request.Header.Set("X-Request-ID", uuid.NewString())
+		// keep the request id from upstream, such as load balancer
+		reqID := c.Request.Header.Get(service.HeaderXRequestID)
+		if !service.ValidRequestID(reqID) {
+			reqID = uuid.NewString()
+			c.Request.Header.Set(service.HeaderXRequestID, reqID)
+		}
+		c.Header(service.HeaderXRequestID, reqID)
 		c.Next()
 	}
 }
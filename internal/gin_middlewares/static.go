@@ -26,7 +26,7 @@ import (
 )
 
 // StatFunc log request & response
-// TODO added prometheus metrics
+// the prometheus metrics are observed by the servers, see LoadMetrics
 func StatFunc(logger logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		reqID := c.Request.Header.Get(service.HeaderXRequestID)
@@ -0,0 +1,172 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+const namespace = "trellis"
+
+// outcomes of calling component
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomePanic   = "panic"
+)
+
+var serviceLabels = []string{"domain", "name", "version", "topic"}
+
+var (
+	serverRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "server",
+		Name:      "requests_total",
+		Help:      "Total number of requests handled by the trellis servers.",
+	}, append([]string{"server", "api", "code"}, serviceLabels...))
+
+	serverRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "server",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests handled by the trellis servers.",
+		Buckets:   prometheus.DefBuckets,
+	}, append([]string{"server", "api"}, serviceLabels...))
+
+	componentCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "component",
+		Name:      "calls_total",
+		Help:      "Total number of component calls by outcome.",
+	}, append([]string{"outcome"}, serviceLabels...))
+
+	componentCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "component",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of component calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, serviceLabels)
+
+	componentInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "component",
+		Name:      "in_flight_calls",
+		Help:      "Number of component calls in flight.",
+	}, serviceLabels)
+
+	remoteCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "remote",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of calling remote nodes.",
+		Buckets:   prometheus.DefBuckets,
+	}, append([]string{"node", "protocol"}, serviceLabels...))
+
+	remoteCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "remote",
+		Name:      "call_errors_total",
+		Help:      "Total number of failed calls to remote nodes.",
+	}, append([]string{"node", "protocol"}, serviceLabels...))
+
+	registryHeartbeats = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "registry",
+		Name:      "heartbeats_total",
+		Help:      "Total number of registry heartbeats by result.",
+	}, []string{"registry", "result", "domain", "name", "version"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		serverRequests,
+		serverRequestDuration,
+		componentCalls,
+		componentCallDuration,
+		componentInFlight,
+		remoteCallDuration,
+		remoteCallErrors,
+		registryHeartbeats,
+	)
+}
+
+func serviceValues(s *service.Service) []string {
+	return []string{s.GetDomain(), s.GetName(), s.GetVersion(), s.GetTopic()}
+}
+
+// UnknownAPI the api label of the requests whose api is not found,
+// the names given by clients are not used as labels to keep the cardinality bounded
+const UnknownAPI = "unknown"
+
+// ServerRequest observe the request handled by the server, code is 0 if no error
+func ServerRequest(server, api string, s *service.Service, code uint64, begin time.Time) {
+	values := append([]string{server, api}, serviceValues(s)...)
+	serverRequestDuration.WithLabelValues(values...).Observe(time.Since(begin).Seconds())
+
+	values = append([]string{server, api, strconv.FormatUint(code, 10)}, serviceValues(s)...)
+	serverRequests.WithLabelValues(values...).Inc()
+}
+
+// ComponentCall observe the outcome of calling component
+func ComponentCall(s *service.Service, err error, begin time.Time) {
+	componentCallDuration.WithLabelValues(serviceValues(s)...).Observe(time.Since(begin).Seconds())
+	componentCalls.WithLabelValues(append([]string{Outcome(err)}, serviceValues(s)...)...).Inc()
+}
+
+// ComponentInFlight count the call of component in flight, the returned function is called once it's done
+func ComponentInFlight(s *service.Service) func() {
+	gauge := componentInFlight.WithLabelValues(serviceValues(s)...)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// RemoteCall observe the call of the remote node
+func RemoteCall(s *service.Service, node, protocol string, err error, begin time.Time) {
+	values := append([]string{node, protocol}, serviceValues(s)...)
+	remoteCallDuration.WithLabelValues(values...).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		remoteCallErrors.WithLabelValues(values...).Inc()
+	}
+}
+
+// RegistryHeartbeat count the heartbeat of the service registered into registry
+func RegistryHeartbeat(registry string, s *service.Service, err error) {
+	result := OutcomeSuccess
+	if err != nil {
+		result = OutcomeError
+	}
+	registryHeartbeats.WithLabelValues(registry, result, s.GetDomain(), s.GetName(), s.GetVersion()).Inc()
+}
+
+// Outcome get the outcome of the error
+func Outcome(err error) string {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	if mErr, ok := err.(*message.Error); ok && mErr.GetCode() == message.ErrCodeComponentPanic {
+		return OutcomePanic
+	}
+	return OutcomeError
+}
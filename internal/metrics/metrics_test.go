@@ -0,0 +1,34 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func TestOutcome(t *testing.T) {
+	testutils.Equals(t, OutcomeSuccess, Outcome(nil))
+	testutils.Equals(t, OutcomeError, Outcome(errors.New("error")))
+	testutils.Equals(t, OutcomeError, Outcome(message.NewError(message.ErrCodeBadRequest, "test", "bad")))
+	testutils.Equals(t, OutcomePanic, Outcome(message.NewError(message.ErrCodeComponentPanic, "test", "panic")))
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket token bucket, which is filled rate tokens per second up to burst
+type Bucket struct {
+	sync.Mutex
+
+	rate  float64
+	burst float64
+
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket new full token bucket
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst <= 0 {
+		burst = int(rate)
+		if burst <= 0 {
+			burst = 1
+		}
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow take one token if there is
+func (p *Bucket) Allow() bool {
+	return p.allowAt(time.Now())
+}
+
+func (p *Bucket) allowAt(now time.Time) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if elapsed := now.Sub(p.last); elapsed > 0 {
+		p.tokens += elapsed.Seconds() * p.rate
+		if p.tokens > p.burst {
+			p.tokens = p.burst
+		}
+		p.last = now
+	}
+
+	if p.tokens < 1 {
+		return false
+	}
+	p.tokens--
+	return true
+}
+
+// refund put back the token taken by Allow, such as the request is rejected by other limits
+func (p *Bucket) refund() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.tokens++
+	if p.tokens > p.burst {
+		p.tokens = p.burst
+	}
+}
+
+// full whether the bucket is refilled, then it could be dropped
+func (p *Bucket) fullAt(now time.Time) bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.tokens+now.Sub(p.last).Seconds()*p.rate >= p.burst
+}
+
+// KeyedBuckets token buckets per key, such as client ip
+type KeyedBuckets struct {
+	sync.Mutex
+
+	rate  float64
+	burst int
+
+	buckets map[string]*Bucket
+	// the refilled buckets are dropped when checking
+	lastPurge time.Time
+}
+
+// NewKeyedBuckets new token buckets per key
+func NewKeyedBuckets(rate float64, burst int) *KeyedBuckets {
+	return &KeyedBuckets{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*Bucket),
+		lastPurge: time.Now(),
+	}
+}
+
+// Allow take one token of the key's bucket if there is
+func (p *KeyedBuckets) Allow(key string) bool {
+	now := time.Now()
+	return p.bucket(key, now).allowAt(now)
+}
+
+func (p *KeyedBuckets) bucket(key string, now time.Time) *Bucket {
+	p.Lock()
+	defer p.Unlock()
+
+	if now.Sub(p.lastPurge) > time.Minute {
+		for k, b := range p.buckets {
+			if b.fullAt(now) {
+				delete(p.buckets, k)
+			}
+		}
+		p.lastPurge = now
+	}
+
+	b, ok := p.buckets[key]
+	if !ok {
+		b = NewBucket(p.rate, p.burst)
+		p.buckets[key] = b
+	}
+	return b
+}
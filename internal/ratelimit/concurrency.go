@@ -0,0 +1,65 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// MaxInFlight limit the in-flight calls of the component,
+// the call waits at most timeout for a free slot, and is rejected if timeout is zero
+func MaxInFlight(max int, timeout time.Duration) component.Middleware {
+	slots := make(chan struct{}, max)
+	return func(next component.Handler) component.Handler {
+		return func(msg message.Message) (interface{}, error) {
+			if !acquire(slots, timeout) {
+				return nil, message.NewError(message.ErrCodeTooManyRequests, msg.Service().TrellisPath(),
+					fmt.Sprintf("too many in-flight calls, max: %d", max)).SetRetryable(true)
+			}
+			defer func() { <-slots }()
+
+			return next(msg)
+		}
+	}
+}
+
+func acquire(slots chan struct{}, timeout time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
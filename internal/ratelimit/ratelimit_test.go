@@ -0,0 +1,131 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func TestBucket(t *testing.T) {
+	b := NewBucket(1, 2)
+	now := b.last
+
+	testutils.Equals(t, true, b.allowAt(now))
+	testutils.Equals(t, true, b.allowAt(now))
+	testutils.Equals(t, false, b.allowAt(now))
+
+	testutils.Equals(t, false, b.allowAt(now.Add(500*time.Millisecond)))
+	testutils.Equals(t, true, b.allowAt(now.Add(time.Second)))
+	testutils.Equals(t, false, b.fullAt(now.Add(time.Second)))
+	testutils.Equals(t, true, b.fullAt(now.Add(3*time.Second)))
+}
+
+func TestAPILimiter(t *testing.T) {
+	_, err := NewAPILimiter(map[string]*Rule{"bad": {Key: "cookie", Rate: 1}})
+	testutils.NotOk(t, err)
+
+	l, err := NewAPILimiter(map[string]*Rule{
+		"per_ip":    {Key: KeyIP, Rate: 0.001, Burst: 1, APIs: []string{"trellis.ping"}},
+		"per_token": {Key: KeyHeader, Header: "X-Api-Token", Rate: 0.001, Burst: 2},
+	})
+	testutils.Ok(t, err)
+
+	h := http.Header{}
+	h.Set("X-Api-Token", "a")
+
+	_, ok := l.Allow("trellis.ping", "127.0.0.1", h)
+	testutils.Equals(t, true, ok)
+
+	rule, ok := l.Allow("trellis.ping", "127.0.0.1", h)
+	testutils.Equals(t, false, ok)
+	testutils.Equals(t, "per_ip", rule)
+
+	// per_ip is not applied to the api
+	_, ok = l.Allow("trellis.pong", "127.0.0.1", h)
+	testutils.Equals(t, true, ok)
+
+	rule, ok = l.Allow("trellis.pong", "127.0.0.1", h)
+	testutils.Equals(t, false, ok)
+	testutils.Equals(t, "per_token", rule)
+}
+
+func TestAPILimiterRefund(t *testing.T) {
+	l, err := NewAPILimiter(map[string]*Rule{
+		"a_token": {Key: KeyHeader, Header: "X-Api-Token", Rate: 0.001, Burst: 2},
+		"per_ip":  {Key: KeyIP, Rate: 0.001, Burst: 1, APIs: []string{"trellis.ping"}},
+	})
+	testutils.Ok(t, err)
+
+	h := http.Header{}
+	h.Set("X-Api-Token", "a")
+
+	_, ok := l.Allow("trellis.ping", "127.0.0.1", h)
+	testutils.Equals(t, true, ok)
+
+	// the token of a_token is refunded when per_ip rejects the request
+	rule, ok := l.Allow("trellis.ping", "127.0.0.1", h)
+	testutils.Equals(t, false, ok)
+	testutils.Equals(t, "per_ip", rule)
+
+	_, ok = l.Allow("trellis.pong", "127.0.0.1", h)
+	testutils.Equals(t, true, ok)
+
+	rule, ok = l.Allow("trellis.pong", "127.0.0.1", h)
+	testutils.Equals(t, false, ok)
+	testutils.Equals(t, "a_token", rule)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	h := MaxInFlight(1, 0)(func(message.Message) (interface{}, error) {
+		entered <- struct{}{}
+		<-release
+		return nil, nil
+	})
+
+	msg := message.NewMessage(message.Service(&service.Service{Name: "test", Version: "v1"}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := h(msg)
+		testutils.Ok(t, err)
+	}()
+	<-entered
+
+	_, err := h(msg)
+	testutils.NotOk(t, err)
+	testutils.Equals(t, message.ErrCodeTooManyRequests, err.(*message.Error).GetCode())
+
+	close(release)
+	wg.Wait()
+
+	go func() { <-entered }()
+	_, err = h(msg)
+	testutils.Ok(t, err)
+}
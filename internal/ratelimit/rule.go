@@ -0,0 +1,127 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// keys of the rate limit rules
+const (
+	KeyAPI    = "api"
+	KeyIP     = "ip"
+	KeyHeader = "header"
+)
+
+// Rule rate limit rule of apis
+type Rule struct {
+	// api, ip or header
+	Key string `json:"key" yaml:"key"`
+	// header name if key is header
+	Header string `json:"header" yaml:"header"`
+	// apis which the rule applies to, all apis if empty
+	APIs []string `json:"apis" yaml:"apis"`
+
+	// tokens per second
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+type apiRule struct {
+	name string
+	rule *Rule
+	apis map[string]bool
+
+	buckets *KeyedBuckets
+}
+
+// APILimiter rate limiter of the apis
+type APILimiter struct {
+	rules []*apiRule
+}
+
+// NewAPILimiter new api rate limiter by rules
+func NewAPILimiter(rules map[string]*Rule) (*APILimiter, error) {
+	l := &APILimiter{}
+	for name, r := range rules {
+		switch r.Key {
+		case KeyAPI, KeyIP:
+		case KeyHeader:
+			if r.Header == "" {
+				return nil, fmt.Errorf("rate limit %s: header is empty", name)
+			}
+		default:
+			return nil, fmt.Errorf("rate limit %s: unknown key: %s", name, r.Key)
+		}
+		if r.Rate <= 0 {
+			return nil, fmt.Errorf("rate limit %s: rate should be positive", name)
+		}
+
+		ar := &apiRule{name: name, rule: r, buckets: NewKeyedBuckets(r.Rate, r.Burst)}
+		if len(r.APIs) != 0 {
+			ar.apis = make(map[string]bool)
+			for _, api := range r.APIs {
+				ar.apis[api] = true
+			}
+		}
+		l.rules = append(l.rules, ar)
+	}
+
+	sort.Slice(l.rules, func(i, j int) bool { return l.rules[i].name < l.rules[j].name })
+	return l, nil
+}
+
+// Allow check all the rules of the api, returns the name of the rule which rejects the request,
+// the tokens taken by the other rules are refunded if the request is rejected
+func (p *APILimiter) Allow(api, clientIP string, header http.Header) (string, bool) {
+	if p == nil {
+		return "", true
+	}
+
+	now := time.Now()
+
+	var taken []*Bucket
+	for _, r := range p.rules {
+		if r.apis != nil && !r.apis[api] {
+			continue
+		}
+
+		var key string
+		switch r.rule.Key {
+		case KeyAPI:
+			key = api
+		case KeyIP:
+			key = clientIP
+		case KeyHeader:
+			key = header.Get(r.rule.Header)
+		}
+
+		b := r.buckets.bucket(key, now)
+		if !b.allowAt(now) {
+			for _, t := range taken {
+				t.refund()
+			}
+			return r.name, false
+		}
+		taken = append(taken, b)
+	}
+	return "", true
+}
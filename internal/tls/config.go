@@ -0,0 +1,61 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/iTrellis/config"
+)
+
+// LoadConfig load the tls config of the clients, such as etcd & grpc,
+// the server is verified by the system roots or ca_file, and the client certificate is loaded from cert_file & key_file,
+// the server is not verified only if insecure_skip_verify is set explicitly
+func LoadConfig(conf config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if conf == nil {
+		return tlsConfig, nil
+	}
+
+	tlsConfig.InsecureSkipVerify = conf.GetBoolean("insecure_skip_verify", false)
+
+	if caFile := conf.GetString("ca_file"); caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in ca_file: %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := conf.GetString("cert_file"), conf.GetString("key_file")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/iTrellis/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+const instrumentationName = "github.com/iTrellis/trellis"
+
+// ShutdownFunc flush and stop the exporter
+type ShutdownFunc func(context.Context) error
+
+func init() {
+	// the propagator is always w3c trace context,
+	// so that the traceparent is forwarded even if the exporter is not enabled
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Init set the global tracer provider which exports spans by otlp grpc exporter,
+// see project.tracing in examples/ping_pong/config.yaml
+func Init(conf config.Config) (ShutdownFunc, error) {
+	if conf == nil || !conf.GetBoolean("enabled", false) {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(conf.GetString("endpoint", "localhost:4317")),
+	}
+	if conf.GetBoolean("insecure", true) {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if timeout := conf.GetTimeDuration("timeout"); timeout > 0 {
+		opts = append(opts, otlptracegrpc.WithTimeout(timeout))
+	}
+
+	ratio := 1.0
+	if r := conf.GetString("sample_ratio"); r != "" {
+		var err error
+		if ratio, err = strconv.ParseFloat(r, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	exporter, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(conf.GetString("service_name", "trellis")))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer get the tracer of trellis
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// PayloadCarrier carries the trace context in the header of payload
+type PayloadCarrier struct {
+	*message.Payload
+}
+
+// Keys list the keys of the payload's header
+func (p PayloadCarrier) Keys() []string {
+	keys := make([]string, 0, len(p.GetHeader()))
+	for k := range p.GetHeader() {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Extract extract the trace context from payload
+func Extract(ctx context.Context, payload *message.Payload) context.Context {
+	if payload == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, PayloadCarrier{payload})
+}
+
+// Inject inject the trace context into payload
+func Inject(ctx context.Context, payload *message.Payload) {
+	if payload == nil {
+		return
+	}
+	otel.GetTextMapPropagator().Inject(ctx, PayloadCarrier{payload})
+}
+
+// StartFromPayload start span whose parent is from the payload,
+// and the payload carries the new span for the next hop
+func StartFromPayload(payload *message.Payload, name string, kind trace.SpanKind,
+	attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+
+	ctx, span := Tracer().Start(Extract(context.Background(), payload), name,
+		trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+
+	Inject(ctx, payload)
+	return ctx, span
+}
+
+// StartFromHTTP start server span whose parent is from the http headers
+func StartFromHTTP(req *http.Request, name string,
+	attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// ServiceAttributes attributes of the service
+func ServiceAttributes(s *service.Service) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("trellis.service.domain", s.GetDomain()),
+		attribute.String("trellis.service.name", s.GetName()),
+		attribute.String("trellis.service.version", s.GetVersion()),
+		attribute.String("trellis.service.topic", s.GetTopic()),
+	}
+}
+
+// End record the error and end the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
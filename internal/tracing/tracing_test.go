@@ -0,0 +1,45 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func TestPayloadPropagation(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+
+	ctx, span := tracer.Start(context.Background(), "root")
+	defer span.End()
+
+	payload := &message.Payload{}
+	Inject(ctx, payload)
+	testutils.Assert(t, payload.Get("traceparent") != "", "traceparent should be injected")
+
+	sc := trace.SpanContextFromContext(Extract(context.Background(), payload))
+	testutils.Equals(t, span.SpanContext().TraceID(), sc.TraceID())
+	testutils.Equals(t, span.SpanContext().SpanID(), sc.SpanID())
+	testutils.Assert(t, sc.IsRemote(), "span context should be remote")
+}
@@ -22,7 +22,11 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/iTrellis/common/logger"
 
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/component"
@@ -31,10 +35,27 @@ import (
 type compManager struct {
 	sync.RWMutex
 
-	components        map[string]component.Component
-	startedComponents map[string]bool
-
+	// serialize the start & stop of components
+	lifecycleLocker sync.Mutex
+
+	// instances of components, keyed by instance name
+	components       map[string]component.Component
+	states           map[string]component.State
+	services         map[string]*service.Service
+	componentOptions map[string]component.Options
+	componentOpts    map[string][]component.Option
+	registerFuncs    map[string]string
+	startedAt        map[string]time.Time
+	instanceNames    []string
+	// instance names keyed by the trellis path of the instance's identity
+	identities map[string]string
+
+	// in-flight starts, which are kept until Start returns even if it exceeded the start timeout
+	starting map[string]*startCall
+
+	// functions of components, keyed by service's trellis path
 	newComponentFuncs map[string]component.NewComponentFunc
+	funcServices      map[string]*service.Service
 	componentNames    []string
 }
 
@@ -43,10 +64,24 @@ func NewCompManager() component.Manager {
 	return &compManager{
 		components:        make(map[string]component.Component),
 		newComponentFuncs: make(map[string]component.NewComponentFunc),
-		startedComponents: make(map[string]bool),
+		funcServices:      make(map[string]*service.Service),
+		states:            make(map[string]component.State),
+		services:          make(map[string]*service.Service),
+		componentOptions:  make(map[string]component.Options),
+		componentOpts:     make(map[string][]component.Option),
+		registerFuncs:     make(map[string]string),
+		startedAt:         make(map[string]time.Time),
+		starting:          make(map[string]*startCall),
+		identities:        make(map[string]string),
 	}
 }
 
+// startCall the Start of the component running in background
+type startCall struct {
+	done chan struct{}
+	err  error
+}
+
 // RegisterComponentFunc register component function
 func (p *compManager) RegisterComponentFunc(s *service.Service, fn component.NewComponentFunc) error {
 
@@ -67,14 +102,15 @@ func (p *compManager) RegisterComponentFunc(s *service.Service, fn component.New
 
 	p.Lock()
 	p.newComponentFuncs[s.TrellisPath()] = fn
+	p.funcServices[s.TrellisPath()] = s
 	p.componentNames = append(p.componentNames, s.TrellisPath())
 	p.Unlock()
 
 	return nil
 }
 
-// RegisterComponent register component
-func (p *compManager) RegisterComponent(s *service.Service, cpt component.Component) error {
+// RegisterComponent register component, the options are only used for describing the component
+func (p *compManager) RegisterComponent(s *service.Service, cpt component.Component, opts ...component.Option) error {
 
 	if s.GetName() == "" {
 		return errors.New("component name is empty")
@@ -91,38 +127,97 @@ func (p *compManager) RegisterComponent(s *service.Service, cpt component.Compon
 		return fmt.Errorf("component already registered: %s", s.TrellisPath())
 	}
 
+	options := component.Options{}
+	for _, o := range opts {
+		o(&options)
+	}
+
 	p.Lock()
 	p.components[s.TrellisPath()] = cpt
-	p.startedComponents[s.TrellisPath()] = true
+	p.states[s.TrellisPath()] = component.StateCreated
+	p.services[s.TrellisPath()] = s
+	p.componentOptions[s.TrellisPath()] = options
+	p.instanceNames = append(p.instanceNames, s.TrellisPath())
 	p.Unlock()
 
 	return nil
 }
 
-// ListComponents get components
+// ListComponents get component instances, and the functions which have no instance
 func (p *compManager) ListComponents() []component.Describe {
 
 	var descs []component.Describe
 
-	for _, name := range p.componentNames {
+	p.RLock()
+	names := append([]string{}, p.instanceNames...)
+	funcNames := append([]string{}, p.componentNames...)
+	p.RUnlock()
+
+	newed := make(map[string]bool)
+	for _, name := range names {
 		p.RLock()
 		cpt := p.components[name]
-		started := p.startedComponents[name]
+		state := p.states[name]
+		s := p.services[name]
+		options := p.componentOptions[name]
+		registerFunc := p.registerFuncs[name]
+		startedAt := p.startedAt[name]
 		p.RUnlock()
 
+		newed[s.TrellisPath()] = true
+
 		desc := component.Describe{
-			Name:    name,
-			Started: started,
+			Name:         name,
+			Service:      s,
+			RegisterFunc: registerFunc,
+			Started:      state == component.StateRunning,
+			State:        state,
+			Logger:       options.Logger,
+			StartTimeout: options.StartTimeout,
+			StopTimeout:  options.StopTimeout,
+			ConfigSource: options.ConfigSource,
+			Registry:     options.Registry,
+		}
+
+		if desc.Started {
+			desc.StartedAt = startedAt
+			desc.Uptime = time.Since(startedAt)
+		}
+
+		for _, dep := range options.Dependencies {
+			desc.Dependencies = append(desc.Dependencies, dep.TrellisPath())
 		}
 
 		if cpt != nil {
-			desc.RegisterFunc = runtime.FuncForPC(reflect.ValueOf(cpt).Pointer()).Name()
+			desc.Type = reflect.TypeOf(cpt).String()
 			desc.Component = cpt
+
+			if dependent, ok := cpt.(component.Dependent); ok {
+				for _, dep := range dependent.Dependencies() {
+					desc.Dependencies = append(desc.Dependencies, dep.TrellisPath())
+				}
+			}
+
+			if lister, ok := cpt.(component.NodeLister); ok {
+				desc.Remote = true
+				desc.Nodes = lister.Nodes()
+			}
 		}
 
 		descs = append(descs, desc)
 	}
 
+	for _, name := range funcNames {
+		if newed[name] {
+			continue
+		}
+		p.RLock()
+		s := p.funcServices[name]
+		fn := p.newComponentFuncs[name]
+		p.RUnlock()
+		descs = append(descs, component.Describe{Name: name, Service: s, RegisterFunc: funcName(fn)})
+	}
+
 	return descs
 }
 
@@ -136,23 +231,96 @@ func (p *compManager) NewComponent(s *service.Service, opts ...component.Option)
 		return nil, fmt.Errorf("component driver '%s' not exist", s.TrellisPath())
 	}
 
+	options := component.Options{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	name := options.Instance
+	if name == "" {
+		name = s.TrellisPath()
+	}
+
+	identity := component.InstanceService(s, name).TrellisPath()
+
+	p.RLock()
+	_, exist := p.components[name]
+	_, identityExist := p.components[identity]
+	if _, ok := p.identities[identity]; ok {
+		identityExist = true
+	}
+	p.RUnlock()
+	if exist {
+		return nil, fmt.Errorf("component instance already exists: %s", name)
+	} else if identityExist {
+		return nil, fmt.Errorf("component instance identity already exists: %s", identity)
+	}
+
+	cpt, err := p.newComponent(name, s, fn, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	p.instanceNames = append(p.instanceNames, name)
+	p.identities[identity] = name
+	p.Unlock()
+
+	return cpt, nil
+}
+
+func (p *compManager) newComponent(name string, s *service.Service, fn component.NewComponentFunc,
+	opts ...component.Option) (component.Component, error) {
+
 	cpt, err := fn(opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	options := component.Options{}
+	for _, o := range opts {
+		o(&options)
+	}
+
 	p.Lock()
-	p.components[s.TrellisPath()] = cpt
-	p.startedComponents[s.TrellisPath()] = true
+	p.components[name] = cpt
+	p.states[name] = component.StateCreated
+	p.services[name] = s
+	p.componentOptions[name] = options
+	p.componentOpts[name] = opts
+	p.registerFuncs[name] = funcName(fn)
 	p.Unlock()
 
 	return cpt, nil
 }
 
-// GetComponent get component
+// GetComponent get component by the identity of the instance, see component.InstanceService
 func (p *compManager) GetComponent(s *service.Service) (cpt component.Component, err error) {
 	p.RLock()
-	cpt, ok := p.components[s.TrellisPath()]
+	name, ok := p.identities[s.TrellisPath()]
+	p.RUnlock()
+	if !ok {
+		name = s.TrellisPath()
+	}
+	return p.GetInstance(name)
+}
+
+// GetLogger get the logger of the instance by it's identity
+func (p *compManager) GetLogger(s *service.Service) logger.Logger {
+	p.RLock()
+	defer p.RUnlock()
+
+	name, ok := p.identities[s.TrellisPath()]
+	if !ok {
+		name = s.TrellisPath()
+	}
+	return p.componentOptions[name].Logger
+}
+
+// GetInstance get component by instance name
+func (p *compManager) GetInstance(name string) (component.Component, error) {
+	p.RLock()
+	cpt, ok := p.components[name]
 	p.RUnlock()
 	if !ok {
 		return nil, errors.New("component is not exists")
@@ -160,6 +328,242 @@ func (p *compManager) GetComponent(s *service.Service) (cpt component.Component,
 	return cpt, nil
 }
 
+// StartComponent start component
+func (p *compManager) StartComponent(name string) error {
+	p.lifecycleLocker.Lock()
+	defer p.lifecycleLocker.Unlock()
+
+	return p.startComponent(name)
+}
+
+func (p *compManager) startComponent(name string) error {
+	p.Lock()
+	cpt, ok := p.components[name]
+	state := p.states[name]
+	options := p.componentOptions[name]
+	_, inFlight := p.starting[name]
+	if !ok {
+		p.Unlock()
+		return fmt.Errorf("component is not exists: %s", name)
+	}
+
+	switch {
+	case inFlight:
+		p.Unlock()
+		return fmt.Errorf("the previous start of component %s has not returned", name)
+	case state == component.StateRunning:
+		p.Unlock()
+		return nil
+	case state == component.StateCreated, state == component.StateStopped, state == component.StateFailed:
+	default:
+		p.Unlock()
+		return fmt.Errorf("component %s could not be started in state: %s", name, state)
+	}
+
+	call := &startCall{done: make(chan struct{})}
+	p.states[name] = component.StateStarting
+	p.starting[name] = call
+	p.Unlock()
+
+	go func() {
+		err := cpt.Start()
+
+		p.Lock()
+		delete(p.starting, name)
+		// the state is changed if the component is stopped after the start timeout
+		if p.states[name] == component.StateStarting && p.components[name] == cpt {
+			if err != nil {
+				p.states[name] = component.StateFailed
+			} else {
+				p.states[name] = component.StateRunning
+				p.startedAt[name] = time.Now()
+			}
+		}
+		p.Unlock()
+
+		call.err = err
+		close(call.done)
+	}()
+
+	if options.StartTimeout <= 0 {
+		<-call.done
+		return call.err
+	}
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-time.After(options.StartTimeout):
+		// the component keeps starting, and it is stopped once Start returns if StopComponent is called
+		return fmt.Errorf("exceeded timeout: %s, component %s is still starting", options.StartTimeout, name)
+	}
+}
+
+// StopComponent stop component
+func (p *compManager) StopComponent(name string) error {
+	p.lifecycleLocker.Lock()
+	defer p.lifecycleLocker.Unlock()
+
+	return p.stopComponent(name)
+}
+
+func (p *compManager) stopComponent(name string) error {
+	p.RLock()
+	cpt, ok := p.components[name]
+	state := p.states[name]
+	options := p.componentOptions[name]
+	call := p.starting[name]
+	p.RUnlock()
+	if !ok {
+		return fmt.Errorf("component is not exists: %s", name)
+	}
+
+	stop := cpt.Stop
+	switch {
+	case state == component.StateRunning:
+	case state == component.StateStarting && call != nil:
+		// the start exceeded its timeout, the component may be started partly,
+		// so it is stopped after Start returns
+		stop = func() error {
+			<-call.done
+			return cpt.Stop()
+		}
+	default:
+		return nil
+	}
+
+	p.setState(name, component.StateStopping)
+	if err := runWithTimeout(stop, options.StopTimeout); err != nil {
+		p.setState(name, component.StateFailed)
+		return err
+	}
+	p.setState(name, component.StateStopped)
+	return nil
+}
+
+// RestartComponent restart component
+func (p *compManager) RestartComponent(name string) error {
+	p.lifecycleLocker.Lock()
+	defer p.lifecycleLocker.Unlock()
+
+	if err := p.stopComponent(name); err != nil {
+		return err
+	}
+
+	p.RLock()
+	s := p.services[name]
+	fn, ok := p.newComponentFuncs[s.TrellisPath()]
+	opts := p.componentOpts[name]
+	p.RUnlock()
+
+	// the stopped component may not be reusable, such as http server, so new it again
+	if ok {
+		if _, err := p.newComponent(name, s, fn, opts...); err != nil {
+			p.setState(name, component.StateFailed)
+			return err
+		}
+	}
+
+	return p.startComponent(name)
+}
+
+// RemoveComponent remove component, it's refused if running components depend on it
+func (p *compManager) RemoveComponent(name string) error {
+	p.lifecycleLocker.Lock()
+	defer p.lifecycleLocker.Unlock()
+
+	if dependents := p.runningDependents(name); len(dependents) != 0 {
+		return fmt.Errorf("component %s is depended on by running components: %s", name, strings.Join(dependents, ", "))
+	}
+
+	if err := p.stopComponent(name); err != nil {
+		return err
+	}
+
+	p.Lock()
+	delete(p.components, name)
+	delete(p.states, name)
+	delete(p.services, name)
+	delete(p.componentOptions, name)
+	delete(p.componentOpts, name)
+	delete(p.registerFuncs, name)
+	delete(p.startedAt, name)
+	for identity, n := range p.identities {
+		if n == name {
+			delete(p.identities, identity)
+		}
+	}
+	for i, n := range p.instanceNames {
+		if n == name {
+			p.instanceNames = append(p.instanceNames[:i], p.instanceNames[i+1:]...)
+			break
+		}
+	}
+	p.Unlock()
+
+	return nil
+}
+
+// runningDependents names of the running components which depend on the component
+func (p *compManager) runningDependents(name string) []string {
+	descs := p.ListComponents()
+
+	paths := map[string]bool{name: true}
+	for _, desc := range descs {
+		if desc.Name == name && desc.Service != nil {
+			paths[desc.Service.TrellisPath()] = true
+			paths[component.InstanceService(desc.Service, name).TrellisPath()] = true
+		}
+	}
+
+	var dependents []string
+	for _, desc := range descs {
+		if desc.Name == name || desc.State != component.StateRunning {
+			continue
+		}
+		for _, dep := range desc.Dependencies {
+			if paths[dep] {
+				dependents = append(dependents, desc.Name)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+func funcName(fn component.NewComponentFunc) string {
+	if fn == nil {
+		return ""
+	}
+	return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+}
+
+func (p *compManager) setState(name string, state component.State) {
+	p.Lock()
+	p.states[name] = state
+	p.Unlock()
+}
+
+// runWithTimeout run the function, return error if exceeded the timeout,
+// timeout is not used if it is zero
+func runWithTimeout(fn func() error, timeout time.Duration) error {
+	if timeout <= 0 {
+		return fn()
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- fn()
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("exceeded timeout: %s", timeout)
+	}
+}
+
 // type compResp struct {
 // 	r   interface{}
 // 	err error
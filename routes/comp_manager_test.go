@@ -0,0 +1,122 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package routes
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+type blockingComponent struct {
+	release chan struct{}
+	starts  int32
+	stops   int32
+}
+
+func (p *blockingComponent) Start() error {
+	atomic.AddInt32(&p.starts, 1)
+	<-p.release
+	return nil
+}
+
+func (p *blockingComponent) Stop() error {
+	atomic.AddInt32(&p.stops, 1)
+	return nil
+}
+
+func (*blockingComponent) Route(message.Message) (interface{}, error) { return nil, nil }
+
+type nopLogger struct{ logger.Logger }
+
+func componentState(m component.Manager, name string) component.State {
+	for _, desc := range m.ListComponents() {
+		if desc.Name == name {
+			return desc.State
+		}
+	}
+	return component.StateCreated
+}
+
+func TestStartComponentTimeout(t *testing.T) {
+	m := NewCompManager()
+	s := &service.Service{Name: "blocking", Version: "v1"}
+	cpt := &blockingComponent{release: make(chan struct{})}
+	testutils.Ok(t, m.RegisterComponent(s, cpt, component.StartTimeout(10*time.Millisecond)))
+
+	name := s.TrellisPath()
+	testutils.NotOk(t, m.StartComponent(name))
+	testutils.Equals(t, component.StateStarting, componentState(m, name))
+
+	// no second Start while the first one has not returned
+	testutils.NotOk(t, m.StartComponent(name))
+	testutils.Equals(t, int32(1), atomic.LoadInt32(&cpt.starts))
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- m.StopComponent(name) }()
+
+	select {
+	case <-stopped:
+		t.Fatal("component stopped before its start returned")
+	case <-time.After(10 * time.Millisecond):
+	}
+	testutils.Equals(t, int32(0), atomic.LoadInt32(&cpt.stops))
+
+	close(cpt.release)
+	testutils.Ok(t, <-stopped)
+	testutils.Equals(t, int32(1), atomic.LoadInt32(&cpt.stops))
+	testutils.Equals(t, component.StateStopped, componentState(m, name))
+}
+
+func TestGetComponentInstances(t *testing.T) {
+	m := NewCompManager()
+	s := &service.Service{Name: "blocking", Version: "v1"}
+	testutils.Ok(t, m.RegisterComponentFunc(s, func(...component.Option) (component.Component, error) {
+		return &blockingComponent{}, nil
+	}))
+
+	def, err := m.NewComponent(s)
+	testutils.Ok(t, err)
+	l := &nopLogger{}
+	admin, err := m.NewComponent(s, component.Instance("admin"), component.Logger(l))
+	testutils.Ok(t, err)
+	_, err = m.NewComponent(s, component.Instance("admin"))
+	testutils.NotOk(t, err)
+
+	cpt, err := m.GetComponent(s)
+	testutils.Ok(t, err)
+	testutils.Assert(t, cpt == def, "default instance expected")
+
+	cpt, err = m.GetComponent(component.InstanceService(s, "admin"))
+	testutils.Ok(t, err)
+	testutils.Assert(t, cpt == admin, "admin instance expected")
+
+	testutils.Assert(t, m.GetLogger(component.InstanceService(s, "admin")) == l, "logger of admin instance expected")
+	testutils.Assert(t, m.GetLogger(s) == nil, "default instance has no logger")
+
+	testutils.Ok(t, m.RemoveComponent("admin"))
+	_, err = m.GetComponent(component.InstanceService(s, "admin"))
+	testutils.NotOk(t, err)
+}
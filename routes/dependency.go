@@ -0,0 +1,85 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iTrellis/trellis/service/component"
+)
+
+// sortByDependencies sort the components so that every component is behind it's dependencies,
+// the registered order is kept for the components without dependency between them,
+// dependencies out of the describes are ignored
+func sortByDependencies(descs []component.Describe) ([]component.Describe, error) {
+
+	index := make(map[string]int, len(descs))
+	for i, desc := range descs {
+		index[desc.Name] = i
+	}
+
+	// in-degrees & reverse edges: dependency -> dependents
+	degrees := make([]int, len(descs))
+	dependents := make([][]int, len(descs))
+	for i, desc := range descs {
+		for _, dep := range desc.Dependencies {
+			j, ok := index[dep]
+			if !ok {
+				continue
+			}
+			if i == j {
+				return nil, fmt.Errorf("component depends on itself: %s", desc.Name)
+			}
+			degrees[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	sorted := make([]component.Describe, 0, len(descs))
+	visited := make([]bool, len(descs))
+
+	for len(sorted) < len(descs) {
+		// pick the first component in registered order which has no unstarted dependency
+		next := -1
+		for i := range descs {
+			if !visited[i] && degrees[i] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			var cycle []string
+			for i, desc := range descs {
+				if !visited[i] {
+					cycle = append(cycle, desc.Name)
+				}
+			}
+			return nil, fmt.Errorf("circular dependencies between components: %s", strings.Join(cycle, ", "))
+		}
+
+		visited[next] = true
+		sorted = append(sorted, descs[next])
+		for _, d := range dependents[next] {
+			degrees[d]--
+		}
+	}
+
+	return sorted, nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package routes
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+func TestSortByDependencies(t *testing.T) {
+	descs := []component.Describe{
+		{Name: "api", Dependencies: []string{"db", "cache"}},
+		{Name: "cache"},
+		{Name: "db", Dependencies: []string{"remote"}},
+		{Name: "log"},
+	}
+
+	sorted, err := sortByDependencies(descs)
+	testutils.Ok(t, err)
+
+	var names []string
+	for _, desc := range sorted {
+		names = append(names, desc.Name)
+	}
+	testutils.Equals(t, []string{"cache", "db", "api", "log"}, names)
+
+	_, err = sortByDependencies([]component.Describe{
+		{Name: "a", Dependencies: []string{"b"}},
+		{Name: "b", Dependencies: []string{"a"}},
+	})
+	testutils.NotOk(t, err)
+
+	_, err = sortByDependencies([]component.Describe{{Name: "a", Dependencies: []string{"a"}}})
+	testutils.NotOk(t, err)
+}
+
+// startedComponent returns a component whose Start returns at once
+func startedComponent() *blockingComponent {
+	release := make(chan struct{})
+	close(release)
+	return &blockingComponent{release: release}
+}
+
+func TestRestartStoppedComponent(t *testing.T) {
+	m := NewCompManager()
+	s := &service.Service{Name: "restart", Version: "v1"}
+	cpt := startedComponent()
+	testutils.Ok(t, m.RegisterComponent(s, cpt))
+
+	name := s.TrellisPath()
+	testutils.Ok(t, m.StartComponent(name))
+	testutils.Ok(t, m.StopComponent(name))
+	testutils.Equals(t, component.StateStopped, componentState(m, name))
+
+	// the stopped component is not stopped again, but started
+	testutils.Ok(t, m.RestartComponent(name))
+	testutils.Equals(t, component.StateRunning, componentState(m, name))
+	testutils.Equals(t, int32(2), atomic.LoadInt32(&cpt.starts))
+	testutils.Equals(t, int32(1), atomic.LoadInt32(&cpt.stops))
+
+	// the component of function is newed again
+	fs := &service.Service{Name: "restart_func", Version: "v1"}
+	testutils.Ok(t, m.RegisterComponentFunc(fs, func(...component.Option) (component.Component, error) {
+		return startedComponent(), nil
+	}))
+	first, err := m.NewComponent(fs)
+	testutils.Ok(t, err)
+	testutils.Ok(t, m.StartComponent(fs.TrellisPath()))
+	testutils.Ok(t, m.RestartComponent(fs.TrellisPath()))
+	testutils.Equals(t, component.StateRunning, componentState(m, fs.TrellisPath()))
+
+	second, err := m.GetComponent(fs)
+	testutils.Ok(t, err)
+	testutils.Assert(t, first != second, "component should be newed again")
+	testutils.Equals(t, int32(1), atomic.LoadInt32(&first.(*blockingComponent).stops))
+}
+
+func TestRemoveRunningComponent(t *testing.T) {
+	m := NewCompManager()
+	s := &service.Service{Name: "remove", Version: "v1"}
+	cpt := startedComponent()
+	testutils.Ok(t, m.RegisterComponent(s, cpt))
+
+	name := s.TrellisPath()
+	testutils.Ok(t, m.StartComponent(name))
+	testutils.Ok(t, m.RemoveComponent(name))
+
+	// the running component is stopped before removed
+	testutils.Equals(t, int32(1), atomic.LoadInt32(&cpt.stops))
+	_, err := m.GetComponent(s)
+	testutils.NotOk(t, err)
+	for _, desc := range m.ListComponents() {
+		testutils.Assert(t, desc.Name != name, "component should be removed: %s", name)
+	}
+	testutils.NotOk(t, m.StartComponent(name))
+}
+
+func TestRemoveDependedComponent(t *testing.T) {
+	m := NewCompManager()
+	db := &service.Service{Name: "db", Version: "v1"}
+	api := &service.Service{Name: "api", Version: "v1"}
+	dbCpt := startedComponent()
+	testutils.Ok(t, m.RegisterComponent(db, dbCpt))
+	testutils.Ok(t, m.RegisterComponent(api, startedComponent(), component.Dependencies(db)))
+
+	testutils.Ok(t, m.StartComponent(db.TrellisPath()))
+	testutils.Ok(t, m.StartComponent(api.TrellisPath()))
+
+	// the dependency of the running component is not removed, nor stopped
+	testutils.NotOk(t, m.RemoveComponent(db.TrellisPath()))
+	testutils.Equals(t, component.StateRunning, componentState(m, db.TrellisPath()))
+	testutils.Equals(t, int32(0), atomic.LoadInt32(&dbCpt.stops))
+
+	// it's removed after the dependent is stopped
+	testutils.Ok(t, m.StopComponent(api.TrellisPath()))
+	testutils.Ok(t, m.RemoveComponent(db.TrellisPath()))
+	_, err := m.GetComponent(db)
+	testutils.NotOk(t, err)
+}
@@ -20,8 +20,14 @@ package routes
 import (
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/iTrellis/common/logger"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/iTrellis/trellis/internal/metrics"
+	"github.com/iTrellis/trellis/internal/tracing"
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/component"
 	"github.com/iTrellis/trellis/service/message"
@@ -35,6 +41,14 @@ type Manager interface {
 
 	CompManager() component.Manager
 
+	// Use append global middlewares wrapping every component call
+	Use(mws ...component.Middleware)
+	// UseService append middlewares wrapping the calls of the service, which is the identity of a component instance
+	UseService(s *service.Service, mws ...component.Middleware)
+
+	// Panics counts of the recovered panics per component
+	Panics() map[string]uint64
+
 	message.Caller
 }
 
@@ -51,6 +65,16 @@ func NewManager(opts ...Option) Manager {
 type manager struct {
 	manager component.Manager
 	logger  logger.Logger
+
+	mwLocker           sync.RWMutex
+	middlewares        []component.Middleware
+	serviceMiddlewares map[string][]component.Middleware
+
+	statsLocker sync.Mutex
+	panics      map[string]uint64
+
+	// serialize starting and stopping of the components
+	lifecycleLocker sync.Mutex
 }
 
 func (p *manager) Init(opts ...Option) {
@@ -68,9 +92,38 @@ func (p *manager) Init(opts ...Option) {
 	}
 
 	p.logger = options.logger
+
+	if p.serviceMiddlewares == nil {
+		p.serviceMiddlewares = make(map[string][]component.Middleware)
+	}
+
+	if p.panics == nil {
+		p.panics = make(map[string]uint64)
+	}
+}
+
+func (p *manager) Use(mws ...component.Middleware) {
+	p.mwLocker.Lock()
+	p.middlewares = append(p.middlewares, mws...)
+	p.mwLocker.Unlock()
+}
+
+func (p *manager) UseService(s *service.Service, mws ...component.Middleware) {
+	p.mwLocker.Lock()
+	p.serviceMiddlewares[s.TrellisPath()] = append(p.serviceMiddlewares[s.TrellisPath()], mws...)
+	p.mwLocker.Unlock()
+}
+
+func (p *manager) getMiddlewares(s *service.Service) []component.Middleware {
+	p.mwLocker.RLock()
+	defer p.mwLocker.RUnlock()
+
+	mws := make([]component.Middleware, 0, len(p.middlewares)+len(p.serviceMiddlewares[s.TrellisPath()]))
+	mws = append(mws, p.middlewares...)
+	return append(mws, p.serviceMiddlewares[s.TrellisPath()]...)
 }
 
-func (p *manager) CallComponent(msg message.Message) (interface{}, error) {
+func (p *manager) CallComponent(msg message.Message) (resp interface{}, err error) {
 
 	cpt, err := p.manager.GetComponent(msg.Service())
 	if err != nil {
@@ -78,49 +131,159 @@ func (p *manager) CallComponent(msg message.Message) (interface{}, error) {
 	} else if cpt == nil {
 		return nil, fmt.Errorf("unknown component")
 	}
-	p.logger.Debug("call_component",
+	// components log with the request id by the logger of the message by default
+	message.SetLogger(msg, component.RequestLogger(p.componentLogger(msg.Service()), msg))
+
+	p.logger.Debug("call_component", "request_id", msg.GetPayload().Get(service.HeaderXRequestID),
 		"component", msg.Service().TrellisPath(), "topic", msg.Topic(), "component_type", reflect.TypeOf(cpt))
 
-	return cpt.Route(msg)
+	_, span := tracing.StartFromPayload(msg.GetPayload(), "trellis.call_component "+msg.Service().TrellisPath(),
+		trace.SpanKindInternal, tracing.ServiceAttributes(msg.Service())...)
+
+	defer func(begin time.Time) {
+		if r := recover(); r != nil {
+			resp, err = nil, panicError(component.MessageLogger(p.logger, msg), msg, r)
+		}
+		// the panics are recovered here, or by the middleware Recovery
+		if metrics.Outcome(err) == metrics.OutcomePanic {
+			p.countPanic(msg.Service().TrellisPath())
+		}
+		metrics.ComponentCall(msg.Service(), err, begin)
+		tracing.End(span, err)
+	}(time.Now())
+
+	return component.Chain(cpt.Route, p.getMiddlewares(msg.Service())...)(msg)
+}
+
+// countPanic count the recovered panic of the component
+func (p *manager) countPanic(path string) {
+	p.statsLocker.Lock()
+	p.panics[path]++
+	p.statsLocker.Unlock()
+}
+
+// componentLogger the logger of the component instance, or the logger of the manager
+func (p *manager) componentLogger(s *service.Service) logger.Logger {
+	if l := p.manager.GetLogger(s); l != nil {
+		return l
+	}
+	return p.logger
+}
+
+func (p *manager) Panics() map[string]uint64 {
+	p.statsLocker.Lock()
+	defer p.statsLocker.Unlock()
+
+	panics := make(map[string]uint64, len(p.panics))
+	for k, v := range p.panics {
+		panics[k] = v
+	}
+	return panics
 }
 
 func (p *manager) Start() (err error) {
 
+	var descs []component.Describe
 	for _, cpt := range p.manager.ListComponents() {
-		if !cpt.Started {
+		// not newed component
+		if cpt.Component == nil {
 			continue
 		}
-		p.logger.Info("start_component", "component", cpt.Name)
+		descs = append(descs, cpt)
+	}
 
-		if cpt.Component == nil {
-			err = fmt.Errorf("component not found: %s", cpt.Name)
-			p.logger.Error("failed_start_component", "component", cpt.Name, "err", err.Error())
+	for _, desc := range descs {
+		for _, dep := range desc.Dependencies {
+			if p.existsComponent(descs, dep) {
+				continue
+			}
+			err = fmt.Errorf("dependency of component %s not found: %s", desc.Name, dep)
+			p.logger.Error("failed_start_component", "component", desc.Name, "err", err.Error())
 			return
 		}
+	}
 
-		if err = cpt.Component.Start(); err != nil {
+	descs, err = sortByDependencies(descs)
+	if err != nil {
+		p.logger.Error("failed_start_component", "err", err.Error())
+		return
+	}
+
+	p.lifecycleLocker.Lock()
+	defer p.lifecycleLocker.Unlock()
+
+	var started []component.Describe
+	for _, cpt := range descs {
+		p.logger.Info("start_component", "component", cpt.Name)
+
+		if err = p.manager.StartComponent(cpt.Name); err != nil {
 			p.logger.Error("failed_start_component", "component", cpt.Name, "err", err.Error())
+
+			// rollback the started components, and the component which is still starting after the timeout
+			p.stopComponents(append(started, cpt))
 			return
 		}
+		started = append(started, cpt)
 		p.logger.Info("start_component", "component", cpt.Name, "result", "ok")
 	}
 
 	return nil
 }
 
+func (p *manager) existsComponent(descs []component.Describe, name string) bool {
+	for _, desc := range descs {
+		if desc.Name == name {
+			return true
+		}
+	}
+
+	// the dependency may be registered component, such as remote components
+	cpt, err := p.manager.GetInstance(name)
+	return err == nil && cpt != nil
+}
+
+// Stop stop the running components in reverse order of dependencies,
+// the components are listed from the states, so that the components started or removed at runtime are included
 func (p *manager) Stop() error {
+	p.lifecycleLocker.Lock()
+	defer p.lifecycleLocker.Unlock()
 
+	var descs []component.Describe
 	for _, cpt := range p.manager.ListComponents() {
-		if !cpt.Started {
+		if cpt.Component == nil {
 			continue
 		}
-		if err := cpt.Component.Stop(); err != nil {
-			p.logger.Error("stop_component", "component", cpt.Name, "err", err.Error())
-			return err
+		switch cpt.State {
+		case component.StateRunning, component.StateStarting:
+			descs = append(descs, cpt)
 		}
 	}
-	// return p.router.Stop()
-	return nil
+
+	sorted, err := sortByDependencies(descs)
+	if err != nil {
+		// the dependencies may be changed at runtime, stop them in registered order
+		p.logger.Warn("stop_component", "err", err.Error())
+		sorted = descs
+	}
+
+	return p.stopComponents(sorted)
+}
+
+// stopComponents stop the components in reverse order, return the first error
+func (p *manager) stopComponents(descs []component.Describe) (err error) {
+	for i := len(descs) - 1; i >= 0; i-- {
+		cpt := descs[i]
+		p.logger.Info("stop_component", "component", cpt.Name)
+		if e := p.manager.StopComponent(cpt.Name); e != nil {
+			p.logger.Error("stop_component", "component", cpt.Name, "err", e.Error())
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		p.logger.Info("stop_component", "component", cpt.Name, "result", "ok")
+	}
+	return
 }
 
 func (p *manager) CompManager() component.Manager {
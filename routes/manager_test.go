@@ -0,0 +1,124 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// routeComponent route the messages by the function
+type routeComponent struct {
+	route func(message.Message) (interface{}, error)
+}
+
+func (*routeComponent) Start() error { return nil }
+func (*routeComponent) Stop() error  { return nil }
+func (p *routeComponent) Route(msg message.Message) (interface{}, error) {
+	return p.route(msg)
+}
+
+func TestMiddlewares(t *testing.T) {
+	m := NewManager(Logger(&nopLogger{}))
+
+	var calls []string
+	mw := func(name string) component.Middleware {
+		return func(next component.Handler) component.Handler {
+			return func(msg message.Message) (interface{}, error) {
+				calls = append(calls, name)
+				return next(msg)
+			}
+		}
+	}
+
+	a := &service.Service{Name: "a", Version: "v1"}
+	b := &service.Service{Name: "b", Version: "v1"}
+	for _, s := range []*service.Service{a, b} {
+		name := s.Name
+		testutils.Ok(t, m.CompManager().RegisterComponent(s, &routeComponent{
+			route: func(message.Message) (interface{}, error) {
+				calls = append(calls, name)
+				return nil, nil
+			}}))
+	}
+
+	m.Use(mw("global1"), mw("global2"))
+	m.UseService(a, mw("a1"))
+
+	// the global middlewares wrap the ones of the service
+	_, err := m.CallComponent(message.NewMessage(message.Service(a)))
+	testutils.Ok(t, err)
+	testutils.Equals(t, []string{"global1", "global2", "a1", "a"}, calls)
+
+	calls = nil
+	_, err = m.CallComponent(message.NewMessage(message.Service(b)))
+	testutils.Ok(t, err)
+	testutils.Equals(t, []string{"global1", "global2", "b"}, calls)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	m := NewManager(Logger(&nopLogger{}))
+
+	s := &service.Service{Name: "panic", Version: "v1"}
+	testutils.Ok(t, m.CompManager().RegisterComponent(s, &routeComponent{
+		route: func(message.Message) (interface{}, error) { panic("boom") }}))
+
+	var outer error
+	m.Use(func(next component.Handler) component.Handler {
+		return func(msg message.Message) (interface{}, error) {
+			resp, err := next(msg)
+			outer = err
+			return resp, err
+		}
+	}, Recovery())
+
+	_, err := m.CallComponent(message.NewMessage(message.Service(s)))
+	testutils.NotOk(t, err)
+	// the outer middleware gets the error instead of the panic
+	testutils.Equals(t, err, outer)
+	testutils.Equals(t, message.ErrCodeComponentPanic, err.(*message.Error).GetCode())
+	testutils.Equals(t, uint64(1), m.Panics()[s.TrellisPath()])
+}
+
+func TestRecoverPanic(t *testing.T) {
+	m := NewManager(Logger(&nopLogger{}))
+
+	s := &service.Service{Name: "panic", Version: "v1"}
+	testutils.Ok(t, m.CompManager().RegisterComponent(s, &routeComponent{
+		route: func(message.Message) (interface{}, error) { panic("boom") }}))
+
+	for i := 1; i <= 2; i++ {
+		resp, err := m.CallComponent(message.NewMessage(message.Service(s)))
+		testutils.Assert(t, resp == nil, "no response of the panic")
+		mErr, ok := err.(*message.Error)
+		testutils.Assert(t, ok, "panic should be converted into message error")
+		testutils.Equals(t, message.ErrCodeComponentPanic, mErr.GetCode())
+		testutils.Equals(t, s.TrellisPath(), mErr.GetNamespace())
+		testutils.Equals(t, uint64(i), m.Panics()[s.TrellisPath()])
+	}
+}
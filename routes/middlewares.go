@@ -0,0 +1,89 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package routes
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/iTrellis/common/logger"
+
+	"github.com/iTrellis/trellis/internal/metrics"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// Logging log the calls with the duration and the error by the logger of the message, see component.MessageLogger
+func Logging() component.Middleware {
+	return func(next component.Handler) component.Handler {
+		return func(msg message.Message) (interface{}, error) {
+			begin := time.Now()
+			resp, err := next(msg)
+
+			l := component.MessageLogger(nil, msg)
+			if l == nil {
+				return resp, err
+			}
+			kvs := []interface{}{"component", msg.Service().TrellisPath(), "topic", msg.Topic(),
+				"duration", time.Since(begin).String()}
+			if err != nil {
+				l.Warn("call_component", append(kvs, "err", err.Error())...)
+			} else {
+				l.Info("call_component", kvs...)
+			}
+			return resp, err
+		}
+	}
+}
+
+// Recovery convert the panics of the next handlers into the errors of ErrCodeComponentPanic,
+// so that the outer middlewares get the errors, the panics are also recovered by the manager without it
+func Recovery() component.Middleware {
+	return func(next component.Handler) component.Handler {
+		return func(msg message.Message) (resp interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					resp, err = nil, panicError(component.MessageLogger(nil, msg), msg, r)
+				}
+			}()
+			return next(msg)
+		}
+	}
+}
+
+// Metrics observe the in-flight calls of the components,
+// the calls and their latencies are always observed by the manager
+func Metrics() component.Middleware {
+	return func(next component.Handler) component.Handler {
+		return func(msg message.Message) (interface{}, error) {
+			defer metrics.ComponentInFlight(msg.Service())()
+			return next(msg)
+		}
+	}
+}
+
+// panicError log the panic with the stack, and convert it into the error of ErrCodeComponentPanic
+func panicError(l logger.Logger, msg message.Message, r interface{}) error {
+	path := msg.Service().TrellisPath()
+	if l != nil {
+		l.Error("component_panic", "component", path, "topic", msg.Topic(),
+			"panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+	}
+	return message.NewError(message.ErrCodeComponentPanic, path, fmt.Sprintf("component panic: %v", r))
+}
@@ -21,16 +21,28 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/iTrellis/node"
+	"github.com/iTrellis/trellis/internal/metrics"
+	"github.com/iTrellis/trellis/internal/tls"
+	"github.com/iTrellis/trellis/internal/tracing"
 	"github.com/iTrellis/trellis/server"
 	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/client"
 	"github.com/iTrellis/trellis/service/client/grpc"
 	"github.com/iTrellis/trellis/service/component"
 	"github.com/iTrellis/trellis/service/message"
 	"github.com/iTrellis/trellis/service/registry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 )
 
 type RemoteComponent interface {
@@ -44,13 +56,19 @@ type remoteComponents struct {
 
 	reg registry.Registry
 
-	s *service.Service
-
 	options  component.Options
 	wOpts    []registry.WatchOption
 	woptions registry.WatchOptions
 
+	watcher registry.Watcher
+
 	nodeManager node.Manager
+	// nodes in the node manager, keyed by node id
+	nodes map[string]*node.Node
+
+	// clients are shared by the calls, so that the connections could be reused
+	httpClient *resty.Client
+	grpcClient client.Client
 }
 
 func NewRemoteComponent(nodeType node.Type, r registry.Registry, wOpts ...registry.WatchOption) (
@@ -58,6 +76,10 @@ func NewRemoteComponent(nodeType node.Type, r registry.Registry, wOpts ...regist
 	c := &remoteComponents{
 		reg:   r,
 		wOpts: wOpts,
+		nodes: make(map[string]*node.Node),
+
+		httpClient: resty.New(),
+		grpcClient: grpc.NewClient(),
 	}
 	for _, o := range wOpts {
 		o(&c.woptions)
@@ -79,10 +101,22 @@ func (p *remoteComponents) Init(opts ...component.Option) {
 }
 
 func (p *remoteComponents) Start() error {
+	// the grpc nodes are called by tls if grpc.tls is configured in the options of the watcher
+	if p.options.Config != nil {
+		if tlsConf := p.options.Config.GetValuesConfig("grpc.tls"); tlsConf != nil {
+			tlsConfig, err := tls.LoadConfig(tlsConf)
+			if err != nil {
+				return err
+			}
+			p.grpcClient = grpc.NewClient(grpc.TransportCredentials(credentials.NewTLS(tlsConfig)))
+		}
+	}
+
 	w, err := p.reg.Watch(p.wOpts...)
 	if err != nil {
 		return err
 	}
+	p.watcher = w
 	go func() {
 		for {
 			result, err := w.Next()
@@ -100,8 +134,14 @@ func (p *remoteComponents) Start() error {
 			switch result.Type {
 			case service.EventType_create, service.EventType_update:
 				p.nodeManager.Add(result.Service.Node)
+				p.Lock()
+				p.nodes[result.Service.Node.ID] = result.Service.Node
+				p.Unlock()
 			case service.EventType_delete:
 				p.nodeManager.RemoveByID(result.Service.Node.ID)
+				p.Lock()
+				delete(p.nodes, result.Service.Node.ID)
+				p.Unlock()
 			}
 		}
 	}()
@@ -109,59 +149,119 @@ func (p *remoteComponents) Start() error {
 }
 
 func (p *remoteComponents) Stop() error {
-	return p.reg.Deregister(p.s)
+	if p.watcher != nil {
+		p.watcher.Stop()
+	}
+	return nil
+}
+
+// Nodes current nodes of the remote service
+func (p *remoteComponents) Nodes() []*node.Node {
+	p.RLock()
+	defer p.RUnlock()
+
+	nodes := make([]*node.Node, 0, len(p.nodes))
+	for _, nd := range p.nodes {
+		nodes = append(nodes, nd)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
 }
 
-func (p *remoteComponents) Route(msg message.Message) (interface{}, error) {
+func (p *remoteComponents) Route(msg message.Message) (resp interface{}, err error) {
 	nd, ok := p.nodeManager.NodeFor(msg.Topic(), msg.GetPayload().Get(service.HeaderXClientIP))
 	if !ok || nd == nil {
 		err := errors.New("not found remote server to call")
 		return nil, err
 	}
 
-	var rep interface{}
-
 	protocol := nd.Metadata["protocol"]
 	if protocol == nil {
 		protocol = service.Protocol_HTTP
 	}
 
+	attrs := append(tracing.ServiceAttributes(msg.Service()),
+		attribute.String("trellis.node", nd.Value), attribute.String("trellis.protocol", fmt.Sprint(protocol)))
+	_, span := tracing.StartFromPayload(msg.GetPayload(), "trellis.remote_call "+msg.Service().TrellisPath(),
+		trace.SpanKindClient, attrs...)
+
+	defer func(begin time.Time) {
+		metrics.RemoteCall(msg.Service(), nd.Value, fmt.Sprint(protocol), err, begin)
+		tracing.End(span, err)
+	}(time.Now())
+
+	// the streamed body could not be sent to the remote servers as it is
+	if err = message.BufferBody(msg); err != nil {
+		return nil, err
+	}
+
 	switch protocol {
 	case service.Protocol_HTTP:
-		client := resty.New()
+		return p.callHTTP(nd, msg)
+	case service.Protocol_GRPC:
+		fallthrough
+	default:
+		return p.callGRPC(nd, msg)
+	}
+}
 
-		remoteMsg := msg.ToRemoteMessage()
+func (p *remoteComponents) callHTTP(nd *node.Node, msg message.Message) (interface{}, error) {
+	remoteMsg := msg.ToRemoteMessage()
 
-		req := client.NewRequest().SetBody(remoteMsg)
+	req := p.httpClient.NewRequest().SetBody(remoteMsg)
+	if reqID := msg.GetPayload().Get(service.HeaderXRequestID); reqID != "" {
+		req.SetHeader(service.HeaderXRequestID, reqID)
+	}
 
-		resp, err := req.Post(nd.Value)
-		if err != nil {
-			return nil, err
-		}
+	resp, err := req.Post(nd.Value)
+	if err != nil {
+		return nil, err
+	}
 
-		r := &server.Response{}
+	r := &server.Response{}
 
-		err = json.Unmarshal(resp.Body(), r)
+	err = json.Unmarshal(resp.Body(), r)
 
-		if err != nil {
-			return nil, err
+	if err != nil {
+		if resp.IsError() {
+			return nil, message.NewError(message.ErrCodeRemoteResponse, nd.Value,
+				fmt.Sprintf("remote server response status: %d", resp.StatusCode()))
 		}
+		return nil, err
+	}
 
-		return r.Result, nil
-	case service.Protocol_GRPC:
-		fallthrough
-	default:
-		c := grpc.NewClient()
+	if rErr := r.GetError(); rErr != nil {
+		return nil, rErr
+	}
 
-		// todo options
-		req := c.NewRequest(msg.Service(), nd.Value, msg.GetPayload().GetBody())
-		ctx := context.Background()
+	return r.Result, nil
+}
 
-		err := c.Call(ctx, req, rep)
-		if err != nil {
-			return nil, err
-		}
+func (p *remoteComponents) callGRPC(nd *node.Node, msg message.Message) (interface{}, error) {
+	// todo options
+	req := p.grpcClient.NewRequest(msg.Service(), nd.Value, msg.GetPayload())
+	ctx := context.Background()
+	if reqID := msg.GetPayload().Get(service.HeaderXRequestID); reqID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(service.HeaderXRequestID), reqID)
 	}
 
+	rsp := &message.Response{}
+	err := p.grpcClient.Call(ctx, req, rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.GetError() != nil {
+		return nil, rsp.GetError()
+	}
+
+	var rep interface{}
+	if len(rsp.GetBody()) == 0 {
+		return rep, nil
+	}
+
+	if err = json.Unmarshal(rsp.GetBody(), &rep); err != nil {
+		return nil, err
+	}
 	return rep, nil
 }
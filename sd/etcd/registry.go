@@ -30,6 +30,8 @@ import (
 	bsf "github.com/iTrellis/common/encryption/binary-formats"
 	"github.com/iTrellis/common/errors"
 	"github.com/iTrellis/node"
+	"github.com/iTrellis/trellis/internal/metrics"
+	"github.com/iTrellis/trellis/internal/tracing"
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/registry"
 
@@ -37,6 +39,8 @@ import (
 	"github.com/mitchellh/hashstructure/v2"
 	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -215,7 +219,12 @@ func (p *etcdRegistry) Register(s *service.Service, opts ...registry.RegisterOpt
 	go func(wr *worker) {
 		var count uint32
 		for {
-			if err := p.registerServiceNode(wr); err != nil {
+			_, span := tracing.Tracer().Start(context.Background(), "trellis.registry.register_node",
+				trace.WithAttributes(p.spanAttributes(&wr.service.Service)...))
+			err := p.registerServiceNode(wr)
+			tracing.End(span, err)
+			metrics.RegistryHeartbeat(p.options.Name, &wr.service.Service, err)
+			if err != nil {
 				p.options.Logger.Warn("failed_and_retry_regsiter", "worker", wr, "error", err.Error(),
 					"retry_times", count, "max_retry_times", p.options.RetryTimes)
 				if p.options.RetryTimes == 0 {
@@ -354,7 +363,11 @@ func (p *etcdRegistry) registerServiceNode(wr *worker) error {
 	return nil
 }
 
-func (p *etcdRegistry) Deregister(s *service.Service, opts ...registry.DeregisterOption) error {
+func (p *etcdRegistry) Deregister(s *service.Service, opts ...registry.DeregisterOption) (err error) {
+	_, span := tracing.Tracer().Start(context.Background(), "trellis.registry.deregister",
+		trace.WithAttributes(p.spanAttributes(s)...))
+	defer func() { tracing.End(span, err) }()
+
 	if s.GetName() == "" {
 		return errors.New("service name not found")
 	}
@@ -409,7 +422,15 @@ func (p *etcdRegistry) stopWorker(w *worker) error {
 	return err
 }
 
-func (p *etcdRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+func (p *etcdRegistry) Watch(opts ...registry.WatchOption) (w registry.Watcher, err error) {
+	var wOpts registry.WatchOptions
+	for _, o := range opts {
+		o(&wOpts)
+	}
+	_, span := tracing.Tracer().Start(context.Background(), "trellis.registry.watch",
+		trace.WithAttributes(p.spanAttributes(&wOpts.Service)...))
+	defer func() { tracing.End(span, err) }()
+
 	cli, err := newClient(p)
 	if err != nil {
 		return nil, err
@@ -417,6 +438,13 @@ func (p *etcdRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, er
 	return newEtcdWatcher(cli, p.id, p.options.Timeout, opts...)
 }
 
+func (p *etcdRegistry) spanAttributes(s *service.Service) []attribute.KeyValue {
+	return append(tracing.ServiceAttributes(s),
+		attribute.String("trellis.registry", p.options.Name),
+		attribute.String("trellis.registry.type", p.String()),
+	)
+}
+
 func encode(nn *registry.Service) string {
 	bs, _ := json.Marshal(nn)
 	return bsf.Encode(bsf.EncodeStd, bs)
@@ -0,0 +1,415 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/common/errors"
+	"github.com/iTrellis/common/logger"
+
+	"github.com/iTrellis/trellis/cmd"
+	"github.com/iTrellis/trellis/configure"
+	"github.com/iTrellis/trellis/internal/addr"
+	"github.com/iTrellis/trellis/internal/gin_middlewares"
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+	"github.com/iTrellis/trellis/version"
+)
+
+var s = &service.Service{Name: "trellis-server-admin", Version: "v1"}
+
+func init() {
+	cmd.DefaultCompManager.RegisterComponentFunc(s, NewAdminServer)
+}
+
+// panicCounter the caller which counts the recovered panics of components
+type panicCounter interface {
+	Panics() map[string]uint64
+}
+
+// levelSetter the logger which supports changing level at runtime
+type levelSetter interface {
+	SetLevel(logger.Level)
+}
+
+type adminServer struct {
+	serverIP string
+
+	redactKeys []string
+
+	options component.Options
+
+	srv *http.Server
+}
+
+// NewAdminServer new admin server, which exposes the informations of the running process
+func NewAdminServer(opts ...component.Option) (component.Component, error) {
+	s := &adminServer{}
+	for _, o := range opts {
+		o(&s.options)
+	}
+
+	if s.options.CompManager == nil {
+		return nil, errors.New("admin server needs components manager")
+	}
+
+	err := s.init()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (p *adminServer) init() error {
+
+	ips := addr.ExternalIPs()
+	if len(ips) > 0 {
+		p.serverIP = ips[0]
+	} else {
+		p.serverIP = "unknown server ip"
+	}
+
+	gin.SetMode(p.options.Config.GetString("gin_mode", gin.ReleaseMode))
+
+	adminConf := p.options.Config.GetValuesConfig("admin")
+
+	p.redactKeys = append(defaultRedactKeys, adminConf.GetStringList("redact_keys")...)
+
+	address := adminConf.GetString("address", defaultAddress)
+	authorization := adminConf.GetString("authorization")
+	if authorization == "" && !isLoopback(address) {
+		return fmt.Errorf("admin.authorization is required when admin server listens on non-loopback address: %s",
+			address)
+	}
+
+	engine := gin.New()
+
+	engine.Use(gin.Recovery(), gin_middlewares.NewRequestID(), gin_middlewares.StatFunc(p.options.Logger))
+	// all the routes are authorized, including pprof and metrics
+	if authorization != "" {
+		engine.Use(authorize(authorization))
+	}
+
+	gin_middlewares.LoadPprof(engine, adminConf.GetValuesConfig("pprof"))
+	gin_middlewares.LoadMetrics(engine, adminConf.GetValuesConfig("metrics"))
+
+	group := engine.Group(adminConf.GetString("prefix", "/admin"))
+
+	group.GET("/components", p.listComponents)
+	group.POST("/components/:action", p.operateComponent)
+	group.GET("/registries", p.listRegistries)
+	group.GET("/nodes", p.listNodes)
+	group.GET("/config", p.effectiveConfig)
+	group.GET("/build_info", p.buildInfo)
+	group.PUT("/log_level", p.setLogLevel)
+	group.DELETE("/api_cache", p.invalidateAPICache)
+
+	p.srv = &http.Server{
+		Addr:    address,
+		Handler: engine,
+	}
+
+	return nil
+}
+
+// authorize abort the requests whose header Authorization is not the authorization
+func authorize(authorization string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.Request.Header.Get("Authorization")), []byte(authorization)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+// defaultAddress the admin server only accepts local connections by default
+const defaultAddress = "127.0.0.1:9090"
+
+// isLoopback whether the address only listens on the loopback interface
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (p *adminServer) Route(message.Message) (interface{}, error) {
+	return nil, nil
+}
+
+func (p *adminServer) Start() error {
+
+	go func() {
+		if err := p.srv.ListenAndServe(); err != nil {
+			if err != http.ErrServerClosed {
+				p.options.Logger.Error("failed_listen_and_serve", "err", err.Error())
+				log.Fatalln(err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *adminServer) Stop() error {
+
+	dur := p.options.Config.GetTimeDuration("admin.shutdown-timeout", time.Second*30)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dur)
+	defer cancel()
+
+	if err := p.srv.Shutdown(ctx); err != nil {
+		return errors.Newf("admin shutdown failure, err: %s", err)
+	}
+	return nil
+}
+
+func (p *adminServer) response(ctx *gin.Context, result interface{}, err error) {
+	r := &server.Response{
+		RequestID: ctx.GetHeader(service.HeaderXRequestID),
+		ClientIP:  addr.GetClientIP(ctx.Request),
+		ServerIP:  p.serverIP,
+		Result:    result,
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		r.SetError(message.FromError(err, s.TrellisPath()))
+		status = http.StatusBadRequest
+	}
+
+	ctx.JSON(status, r)
+}
+
+type componentsInfo struct {
+	Components []component.Describe `json:"components"`
+	Panics     map[string]uint64    `json:"panics,omitempty"`
+}
+
+func (p *adminServer) listComponents(ctx *gin.Context) {
+	info := componentsInfo{Components: p.options.CompManager.ListComponents()}
+	if pc, ok := p.options.Caller.(panicCounter); ok {
+		info.Panics = pc.Panics()
+	}
+	p.response(ctx, info, nil)
+}
+
+// operateComponent start, stop, restart or remove the component instance
+// POST /components/:action?name=instance
+func (p *adminServer) operateComponent(ctx *gin.Context) {
+	name := ctx.Query("name")
+	if name == "" {
+		p.response(ctx, nil, message.NewError(message.ErrCodeBadRequest, s.TrellisPath(), "name is empty"))
+		return
+	}
+
+	var err error
+	switch action := ctx.Param("action"); action {
+	case "start":
+		err = p.options.CompManager.StartComponent(name)
+	case "stop":
+		err = p.options.CompManager.StopComponent(name)
+	case "restart":
+		err = p.options.CompManager.RestartComponent(name)
+	case "remove":
+		err = p.options.CompManager.RemoveComponent(name)
+	default:
+		err = message.NewError(message.ErrCodeBadRequest, s.TrellisPath(),
+			fmt.Sprintf("unknown action: %s", action))
+	}
+
+	p.options.Logger.Info("operate_component", "action", ctx.Param("action"), "name", name, "err", err)
+
+	p.response(ctx, nil, err)
+}
+
+type registryInfo struct {
+	Name       string               `json:"name"`
+	Type       string               `json:"type"`
+	Endpoints  []string             `json:"endpoints,omitempty"`
+	ServerAddr string               `json:"server_addr,omitempty"`
+	Registered []string             `json:"registered,omitempty"`
+	Watchers   []component.Describe `json:"watchers,omitempty"`
+}
+
+func (p *adminServer) listRegistries(ctx *gin.Context) {
+	regs := make(map[string]*registryInfo)
+
+	if p.options.ProjectConfig != nil {
+		regConfigs := make(map[string]*configure.Registry)
+		if err := p.options.ProjectConfig.ToObject("project.registries", &regConfigs); err != nil {
+			p.response(ctx, nil, err)
+			return
+		}
+		for key, rc := range regConfigs {
+			regs[key] = &registryInfo{
+				Name:       key,
+				Type:       rc.Type.String(),
+				Endpoints:  rc.Endpoints,
+				ServerAddr: rc.ServerAddr,
+			}
+		}
+	}
+
+	for _, desc := range p.options.CompManager.ListComponents() {
+		if desc.Registry == "" {
+			continue
+		}
+		ri, ok := regs[desc.Registry]
+		if !ok {
+			ri = &registryInfo{Name: desc.Registry}
+			regs[desc.Registry] = ri
+		}
+		if desc.Remote {
+			ri.Watchers = append(ri.Watchers, desc)
+		} else {
+			ri.Registered = append(ri.Registered, desc.Name)
+		}
+	}
+
+	infos := make([]*registryInfo, 0, len(regs))
+	for _, ri := range regs {
+		infos = append(infos, ri)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	p.response(ctx, infos, nil)
+}
+
+func (p *adminServer) listNodes(ctx *gin.Context) {
+	nodes := make(map[string]interface{})
+	for _, desc := range p.options.CompManager.ListComponents() {
+		if !desc.Remote {
+			continue
+		}
+		nodes[desc.Name] = desc.Nodes
+	}
+	p.response(ctx, nodes, nil)
+}
+
+func (p *adminServer) effectiveConfig(ctx *gin.Context) {
+	if p.options.ProjectConfig == nil {
+		p.response(ctx, nil, nil)
+		return
+	}
+
+	project := configure.Project{}
+	if err := p.options.ProjectConfig.ToObject("project", &project); err != nil {
+		p.response(ctx, nil, err)
+		return
+	}
+
+	project.Tracing = redactOptions(project.Tracing, p.redactKeys)
+	for _, sc := range project.Services {
+		sc.Options = redactOptions(sc.Options, p.redactKeys)
+	}
+	for _, rc := range project.Registries {
+		for i := range rc.Watchers {
+			rc.Watchers[i].Options = redactOptions(rc.Watchers[i].Options, p.redactKeys)
+		}
+	}
+
+	p.response(ctx, project, nil)
+}
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	BuildInfo string `json:"build_info"`
+}
+
+func (p *adminServer) buildInfo(ctx *gin.Context) {
+	p.response(ctx, buildInfo{Version: version.Version(), BuildInfo: version.BuildInfo()}, nil)
+}
+
+type logLevelRequest struct {
+	Level *logger.Level `json:"level"`
+}
+
+func (p *adminServer) setLogLevel(ctx *gin.Context) {
+	req := logLevelRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Level == nil {
+		p.response(ctx, nil, message.NewError(message.ErrCodeBadRequest, s.TrellisPath(), "bad log level"))
+		return
+	}
+
+	setter, ok := p.options.Logger.(levelSetter)
+	if !ok {
+		p.response(ctx, nil, message.NewError(message.ErrCodeBadRequest, s.TrellisPath(),
+			"logger not supports changing level"))
+		return
+	}
+
+	setter.SetLevel(*req.Level)
+	p.options.Logger.Info("set_log_level", "level", *req.Level)
+
+	p.response(ctx, nil, nil)
+}
+
+// topicInvalidateCache the topic of the api server to invalidate the cached responses
+const topicInvalidateCache = "invalidate_cache"
+
+// invalidateAPICache invalidate the cached responses of the api server instance
+// DELETE /api_cache?name=trellis-postapi&version=v1&api=name, all the apis if api is empty
+func (p *adminServer) invalidateAPICache(ctx *gin.Context) {
+	if p.options.Caller == nil {
+		p.response(ctx, nil, message.NewError(message.ErrCodeBadRequest, s.TrellisPath(), "caller not found"))
+		return
+	}
+
+	body, err := json.Marshal(map[string]string{"api": ctx.Query("api")})
+	if err != nil {
+		p.response(ctx, nil, err)
+		return
+	}
+
+	msg := message.NewMessage(
+		message.Service(&service.Service{
+			Domain:  ctx.Query("domain"),
+			Name:    ctx.DefaultQuery("name", "trellis-postapi"),
+			Version: ctx.DefaultQuery("version", "v1"),
+			Topic:   topicInvalidateCache,
+		}),
+		message.MessagePayload(&message.Payload{
+			Header: map[string]string{service.HeaderXRequestID: ctx.GetHeader(service.HeaderXRequestID)},
+			Body:   body,
+		}),
+	)
+
+	deleted, err := p.options.Caller.CallComponent(msg)
+	p.options.Logger.Info("invalidate_api_cache", "service", msg.Service(), "api", ctx.Query("api"), "err", err)
+
+	p.response(ctx, deleted, err)
+}
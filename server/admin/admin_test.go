@@ -0,0 +1,83 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/common/testutils"
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/routes"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+type nopLogger struct{ logger.Logger }
+
+func (nopLogger) Info(string, ...interface{}) {}
+
+func TestIsLoopback(t *testing.T) {
+	testutils.Assert(t, isLoopback(defaultAddress), "default address should be loopback")
+	testutils.Assert(t, isLoopback("localhost:9090"), "localhost should be loopback")
+	testutils.Assert(t, isLoopback("[::1]:9090"), "::1 should be loopback")
+	testutils.Assert(t, !isLoopback(":9090"), "all interfaces should not be loopback")
+	testutils.Assert(t, !isLoopback("0.0.0.0:9090"), "all interfaces should not be loopback")
+	testutils.Assert(t, !isLoopback("10.0.0.1:9090"), "private address should not be loopback")
+}
+
+func TestAuthorizePprof(t *testing.T) {
+	cpt, err := NewAdminServer(
+		component.Config(config.Options{
+			"admin": map[string]interface{}{
+				"address":       ":9090",
+				"authorization": "admin",
+				"pprof":         map[string]interface{}{"enabled": true, "prefix": "/debug/pprof"},
+				"metrics":       map[string]interface{}{"enabled": true},
+			},
+		}.ToConfig()),
+		component.CompManager(routes.NewCompManager()),
+		component.Logger(nopLogger{}),
+	)
+	testutils.Ok(t, err)
+	handler := cpt.(*adminServer).srv.Handler
+
+	for _, path := range []string{"/debug/pprof/", "/metrics", "/admin/build_info"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		testutils.Equals(t, http.StatusUnauthorized, w.Code)
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "admin")
+		handler.ServeHTTP(w, req)
+		testutils.Equals(t, http.StatusOK, w.Code)
+	}
+
+	// pprof could not be exposed on all interfaces without authorization
+	_, err = NewAdminServer(
+		component.Config(config.Options{
+			"admin": map[string]interface{}{"address": ":9090"},
+		}.ToConfig()),
+		component.CompManager(routes.NewCompManager()),
+		component.Logger(nopLogger{}),
+	)
+	testutils.NotOk(t, err)
+}
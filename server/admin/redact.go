@@ -0,0 +1,84 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package admin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iTrellis/config"
+)
+
+const redacted = "******"
+
+// keys of the options which contain these words are redacted
+var defaultRedactKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "credential", "private", "dsn",
+}
+
+func redactOptions(opts config.Options, keys []string) config.Options {
+	if opts == nil {
+		return nil
+	}
+	out := make(config.Options, len(opts))
+	for k, v := range opts {
+		out[k] = redactValue(k, v, keys)
+	}
+	return out
+}
+
+func redactValue(key string, v interface{}, keys []string) interface{} {
+	if isSensitive(key, keys) {
+		return redacted
+	}
+
+	switch vt := v.(type) {
+	case config.Options:
+		return map[string]interface{}(redactOptions(vt, keys))
+	case map[string]interface{}:
+		return map[string]interface{}(redactOptions(vt, keys))
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vt))
+		for k, value := range vt {
+			sk := fmt.Sprint(k)
+			m[sk] = redactValue(sk, value, keys)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, 0, len(vt))
+		for _, value := range vt {
+			list = append(list, redactValue("", value, keys))
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+func isSensitive(key string, keys []string) bool {
+	if key == "" {
+		return false
+	}
+	key = strings.ToLower(key)
+	for _, k := range keys {
+		if strings.Contains(key, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
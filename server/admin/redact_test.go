@@ -0,0 +1,49 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package admin
+
+import (
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+	"github.com/iTrellis/config"
+)
+
+func TestRedactOptions(t *testing.T) {
+	opts := config.Options{
+		"address": ":8080",
+		"mysql": map[interface{}]interface{}{
+			"user":     "root",
+			"Password": "123456",
+		},
+		"tokens": []interface{}{"a", "b"},
+		"list": []interface{}{
+			map[string]interface{}{"secret_key": "abc", "name": "n"},
+		},
+	}
+
+	out := redactOptions(opts, defaultRedactKeys)
+
+	testutils.Equals(t, ":8080", out["address"])
+	testutils.Equals(t, map[string]interface{}{"user": "root", "Password": redacted}, out["mysql"])
+	testutils.Equals(t, redacted, out["tokens"])
+	testutils.Equals(t, []interface{}{map[string]interface{}{"secret_key": redacted, "name": "n"}},
+		out["list"])
+
+	testutils.Equals(t, "123456", opts["mysql"].(map[interface{}]interface{})["Password"])
+}
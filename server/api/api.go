@@ -18,8 +18,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package api
 
 import (
-	"github.com/google/uuid"
-	"github.com/iTrellis/trellis/service"
+	"strings"
+	"time"
+
+	"github.com/iTrellis/trellis/server/gateway"
 )
 
 // APITableName default api
@@ -27,59 +29,121 @@ var APITableName = "api"
 
 // API api struct
 type API struct {
-	ID             string `xorm:"id"`
-	Name           string `xorm:"name"`
-	ServiceDomain  string `xorm:"service_domain"`
-	ServiceName    string `xorm:"service_name"`
-	ServiceVersion string `xorm:"service_version"`
-	Topic          string `xorm:"topic"`
-	Status         string `xorm:"status"`
+	ID             string `xorm:"id" json:"id"`
+	Name           string `xorm:"name" json:"name"`
+	ServiceDomain  string `xorm:"service_domain" json:"service_domain"`
+	ServiceName    string `xorm:"service_name" json:"service_name"`
+	ServiceVersion string `xorm:"service_version" json:"service_version"`
+	Topic          string `xorm:"topic" json:"topic"`
+	Status         string `xorm:"status" json:"status"`
+
+	// Method & Path declare the http route of the api, such as GET /users/:id,
+	// the api could only be called by X-Api header if path is empty
+	Method string `xorm:"method" json:"method"`
+	Path   string `xorm:"path" json:"path"`
+	// Headers comma separated http headers forwarded into payload
+	Headers string `xorm:"headers" json:"headers"`
+
+	// Anonymous whether the api could be called without credentials when auth is enabled
+	Anonymous bool `xorm:"anonymous" json:"anonymous"`
+	// Roles comma separated roles, the principal should have one of them, any principal if empty
+	Roles string `xorm:"roles" json:"roles"`
+
+	// Versions comma separated weights of the service versions, such as v1:95,v2:5
+	Versions string `xorm:"versions" json:"versions"`
+	// Rules comma separated header rules of the service versions, such as X-Canary=true:v2,
+	// the rules are matched before the weights, value * matches any non-empty header
+	Rules string `xorm:"rules" json:"rules"`
+
+	// RequestSchema & ResponseSchema validate the bodies, see compileSchema for the references
+	RequestSchema  string `xorm:"request_schema" json:"request_schema"`
+	ResponseSchema string `xorm:"response_schema" json:"response_schema"`
+
+	// CacheTTL the successful responses are cached for the duration, such as 30s, not cached if empty
+	CacheTTL string `xorm:"cache_ttl" json:"cache_ttl"`
+	// CacheHeaders comma separated headers which are parts of the cache key
+	CacheHeaders string `xorm:"cache_headers" json:"cache_headers"`
+	// CacheMaxSize the results larger than it are not cached, default is http.cache.max_size
+	CacheMaxSize int `xorm:"cache_max_size" json:"cache_max_size"`
+
+	// MaxBodySize max size of the request body, default is http.max_body_size, no limit if it's negative
+	MaxBodySize int64 `xorm:"max_body_size" json:"max_body_size"`
+
+	// ResponseMode envelope, raw or problem, default is http.response_mode, see gateway.ResponseMode
+	ResponseMode string `xorm:"response_mode" json:"response_mode"`
+
+	// UpdatedAt the sql store only loads the apis updated since the last sync
+	UpdatedAt time.Time `xorm:"updated_at updated" json:"updated_at"`
 }
 
-// TableName database table name
-func (*API) TableName() string {
-	return APITableName
+// RoleList roles of the api
+func (p *API) RoleList() []string {
+	return splitList(p.Roles)
 }
 
-func (p *httpServer) syncAPIs(s *service.Service) {
-	for {
-		syncID := uuid.NewString()
-		p.options.Logger.Info("start_sync_apis", "sync", syncID, "service", s)
+// VersionList weights of the service versions
+func (p *API) VersionList() []string {
+	return splitList(p.Versions)
+}
 
-		parmas := map[string]interface{}{"`status`": "normal"}
+// RuleList header rules of the service versions
+func (p *API) RuleList() []string {
+	return splitList(p.Rules)
+}
 
-		if s.GetDomain() != "" {
-			parmas["`service_domain`"] = s.GetDomain()
-		}
+// Mode response mode of the api, the default mode of the gateway if it is empty or unknown
+func (p *API) Mode() gateway.ResponseMode {
+	mode, _ := gateway.ParseResponseMode(p.ResponseMode)
+	return mode
+}
 
-		if s.GetName() != "" {
-			parmas["`service_name`"] = s.GetName()
-		}
+// HeaderList headers forwarded into payload
+func (p *API) HeaderList() []string {
+	return splitList(p.Headers)
+}
 
-		if s.GetName() != "" {
-			parmas["`service_version`"] = s.GetVersion()
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
 		}
+	}
+	return list
+}
 
-		var apis []*API
-		if err := p.apiEngine.Where(parmas).Find(&apis); err != nil {
-			p.options.Logger.Error("sync_apis_failed", "sync", syncID, "err", err.Error())
-			<-p.ticker.C
-			continue
-		}
+// TableName database table name
+func (*API) TableName() string {
+	return APITableName
+}
 
-		lenAPI := len(apis)
-		mapAPIs := make(map[string]*API, lenAPI)
+// setAPIs replace the apis of the pipeline, and the http routes and cache policies of the served apis
+func (p *httpServer) setAPIs(apis map[string]*API) {
+	// the apis whose schemas are invalid are not served
+	p.pipeline.SetAPIs(apis)
+	apis = p.pipeline.APIs()
 
-		for i := 0; i < lenAPI; i++ {
-			p.options.Logger.Debug("add_new_api", "api", apis[i])
-			mapAPIs[apis[i].Name] = apis[i]
-		}
+	rs, errs := newRoutes(apis)
+	for _, err := range errs {
+		p.options.Logger.Error("invalid_api_route", "err", err.Error())
+	}
 
-		p.syncer.Lock()
-		p.apis = mapAPIs
-		p.syncer.Unlock()
-		p.options.Logger.Info("end_sync_apis", "sync", syncID, "service", s)
+	policies := make(map[string]*cachePolicy)
+	for name, api := range apis {
+		if _, err := gateway.ParseResponseMode(api.ResponseMode); err != nil {
+			p.options.Logger.Error("invalid_api_response_mode", "api_name", name, "err", err.Error())
+		}
 
-		<-p.ticker.C
+		cp, err := newCachePolicy(api, p.cacheMaxSize)
+		if err != nil {
+			p.options.Logger.Error("invalid_api_cache", "err", err.Error())
+		} else if cp != nil {
+			policies[name] = cp
+		}
 	}
+
+	p.syncer.Lock()
+	p.routes = rs
+	p.cachePolicies = policies
+	p.syncer.Unlock()
 }
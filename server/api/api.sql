@@ -4,6 +4,8 @@
 -- Date: 2020-09-15 11:59
 */
 
+-- the existing tables created before the columns of routes, auth, splits, schemas, cache & body limits
+-- are upgraded by api_upgrade.sql
 CREATE TABLE `api` (
   `id` varchar(50) NOT NULL DEFAULT '',
   `name` varchar(200) NOT NULL DEFAULT '',
@@ -12,7 +14,23 @@ CREATE TABLE `api` (
   `service_version` varchar(50) NOT NULL DEFAULT '',
   `topic` varchar(100) NOT NULL DEFAULT '',
   `status` varchar(50) NOT NULL DEFAULT 'normal',
-  PRIMARY KEY (`id`)
+  `method` varchar(10) NOT NULL DEFAULT '',
+  `path` varchar(200) NOT NULL DEFAULT '',
+  `headers` varchar(500) NOT NULL DEFAULT '',
+  `anonymous` tinyint(1) NOT NULL DEFAULT 0,
+  `roles` varchar(500) NOT NULL DEFAULT '',
+  `versions` varchar(500) NOT NULL DEFAULT '',
+  `rules` varchar(500) NOT NULL DEFAULT '',
+  `request_schema` text DEFAULT NULL,
+  `response_schema` text DEFAULT NULL,
+  `cache_ttl` varchar(20) NOT NULL DEFAULT '',
+  `cache_headers` varchar(500) NOT NULL DEFAULT '',
+  `cache_max_size` int(11) NOT NULL DEFAULT 0,
+  `max_body_size` bigint(20) NOT NULL DEFAULT 0,
+  `response_mode` varchar(20) NOT NULL DEFAULT '',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_updated_at` (`updated_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
 
@@ -0,0 +1,23 @@
+
+/*
+-- Upgrade the api table created by the old api.sql,
+-- which only has the columns: id, name, service_domain, service_name, service_version, topic, status
+*/
+
+ALTER TABLE `api`
+  ADD COLUMN `method` varchar(10) NOT NULL DEFAULT '',
+  ADD COLUMN `path` varchar(200) NOT NULL DEFAULT '',
+  ADD COLUMN `headers` varchar(500) NOT NULL DEFAULT '',
+  ADD COLUMN `anonymous` tinyint(1) NOT NULL DEFAULT 0,
+  ADD COLUMN `roles` varchar(500) NOT NULL DEFAULT '',
+  ADD COLUMN `versions` varchar(500) NOT NULL DEFAULT '',
+  ADD COLUMN `rules` varchar(500) NOT NULL DEFAULT '',
+  ADD COLUMN `request_schema` text DEFAULT NULL,
+  ADD COLUMN `response_schema` text DEFAULT NULL,
+  ADD COLUMN `cache_ttl` varchar(20) NOT NULL DEFAULT '',
+  ADD COLUMN `cache_headers` varchar(500) NOT NULL DEFAULT '',
+  ADD COLUMN `cache_max_size` int(11) NOT NULL DEFAULT 0,
+  ADD COLUMN `max_body_size` bigint(20) NOT NULL DEFAULT 0,
+  ADD COLUMN `response_mode` varchar(20) NOT NULL DEFAULT '',
+  ADD COLUMN `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  ADD KEY `idx_updated_at` (`updated_at`);
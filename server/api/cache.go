@@ -0,0 +1,281 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/server/auth"
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service"
+)
+
+// ResponseCache the cache of the apis' responses
+type ResponseCache interface {
+	Get(key string) ([]byte, bool)
+	// Set set the value of key, which is expired after ttl
+	Set(key string, value []byte, ttl time.Duration)
+	// DeletePrefix delete the keys with the prefix, returns the number of the deleted keys
+	DeletePrefix(prefix string) int
+}
+
+// NewResponseCacheFunc new response cache with the config of http.cache
+type NewResponseCacheFunc func(conf config.Config) (ResponseCache, error)
+
+var (
+	cachesLocker sync.RWMutex
+	cacheFuncs   = map[string]NewResponseCacheFunc{
+		"lru": NewLRUCache,
+	}
+)
+
+// RegisterResponseCache register the response cache of the type, which could be used by http.cache.type
+func RegisterResponseCache(typ string, fn NewResponseCacheFunc) {
+	if fn == nil {
+		panic("response cache function should not be nil")
+	}
+
+	cachesLocker.Lock()
+	defer cachesLocker.Unlock()
+	if _, ok := cacheFuncs[typ]; ok {
+		panic(fmt.Errorf("response cache already exists: %s", typ))
+	}
+	cacheFuncs[typ] = fn
+}
+
+// NewResponseCache new response cache by http.cache.type, default is lru
+func NewResponseCache(conf config.Config) (ResponseCache, error) {
+	typ := conf.GetString("type", "lru")
+
+	cachesLocker.RLock()
+	fn, ok := cacheFuncs[typ]
+	cachesLocker.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown response cache type: %s", typ)
+	}
+	return fn(conf)
+}
+
+// cachePolicy the cache policy of the api
+type cachePolicy struct {
+	ttl     time.Duration
+	headers []string
+	// maxSize the max size of the cached result
+	maxSize int
+}
+
+// newCachePolicy parse the cache policy of the api, nil if the api is not cached
+func newCachePolicy(api *API, defaultMaxSize int) (*cachePolicy, error) {
+	if api.CacheTTL == "" {
+		return nil, nil
+	}
+
+	ttl, err := time.ParseDuration(api.CacheTTL)
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("api %s: bad cache ttl: %s", api.Name, api.CacheTTL)
+	}
+
+	cp := &cachePolicy{ttl: ttl, headers: splitList(api.CacheHeaders), maxSize: api.CacheMaxSize}
+	if cp.maxSize <= 0 {
+		cp.maxSize = defaultMaxSize
+	}
+	sort.Strings(cp.headers)
+	return cp, nil
+}
+
+// cacheKeyPrefix all the keys of the api have the prefix
+func cacheKeyPrefix(apiName string) string {
+	return apiName + "\x00"
+}
+
+// key the cache key of the request, built from the picked service version, path, query, body,
+// the selected headers and the principal, so the responses of the authenticated apis are not shared between principals
+func (p *cachePolicy) key(apiName, version string, req *http.Request, body []byte, principal *auth.Principal) string {
+	h := sha256.New()
+	h.Write([]byte(version))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.RawQuery))
+	h.Write([]byte{0})
+	for _, name := range p.headers {
+		h.Write([]byte(name + ":" + req.Header.Get(name)))
+		h.Write([]byte{0})
+	}
+	if principal != nil {
+		h.Write([]byte(principal.Authenticator + ":" + principal.ID))
+	}
+	h.Write([]byte{0})
+	h.Write(body)
+
+	return cacheKeyPrefix(apiName) + hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheControl the directives of the request's Cache-Control header
+type cacheControl struct {
+	// noStore the response is neither read from nor written into the cache
+	noStore bool
+	// noCache the response is not read from the cache, but could be written
+	noCache bool
+	// maxAge the cached response should not be older than it, -1 if not set
+	maxAge int
+}
+
+func parseCacheControl(header string) cacheControl {
+	cc := cacheControl{maxAge: -1}
+	for _, d := range strings.Split(header, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store":
+			cc.noStore = true
+		case d == "no-cache":
+			cc.noCache = true
+		case strings.HasPrefix(d, "max-age="):
+			if age, err := strconv.Atoi(strings.TrimPrefix(d, "max-age=")); err == nil && age >= 0 {
+				cc.maxAge = age
+			}
+		}
+	}
+	return cc
+}
+
+// cachedResponse the response stored in the cache
+type cachedResponse struct {
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	// Raw the body of server.RawResult, Result is empty if it is set
+	Raw         []byte            `json:"raw,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Header      map[string]string `json:"header,omitempty"`
+	CreatedAt   int64             `json:"created_at"`
+}
+
+// HeaderXCache HIT if the response is served from the cache, MISS if not
+const HeaderXCache = "X-Cache"
+
+// serveCached serve the cached response, maxAge is the max age in seconds accepted by the request
+func (p *httpServer) serveCached(gCtx *gin.Context, mode gateway.ResponseMode, r *server.Response, key string, maxAge int) bool {
+	data, ok := p.cache.Get(key)
+	if !ok {
+		return false
+	}
+
+	cached := &cachedResponse{}
+	if err := json.Unmarshal(data, cached); err != nil {
+		p.options.Logger.Error("bad_cached_response", "key", key, "err", err.Error())
+		return false
+	}
+
+	age := time.Now().Unix() - cached.CreatedAt
+	if age < 0 {
+		age = 0
+	}
+	if maxAge >= 0 && age > int64(maxAge) {
+		return false
+	}
+
+	gCtx.Header(HeaderXCache, "HIT")
+	gCtx.Header("Age", strconv.FormatInt(age, 10))
+	if cached.ContentType != "" {
+		p.gateway.ReplyAs(gCtx, mode, r, &server.RawResult{
+			HTTPCode: cached.Status, ContentType: cached.ContentType, Header: cached.Header, Body: cached.Raw})
+	} else {
+		p.gateway.ReplyAs(gCtx, mode, r, &server.InnerResult{HTTPCode: cached.Status, Body: cached.Result})
+	}
+	return true
+}
+
+// storeCached store the result of the response, the redirections and the large results are not cached
+func (p *httpServer) storeCached(policy *cachePolicy, key string, resp interface{}) {
+	cached := &cachedResponse{Status: http.StatusOK, CreatedAt: time.Now().Unix()}
+	switch t := resp.(type) {
+	case InnerResult:
+		cached.Status, resp = t.HTTPCode, t.Body
+	case *InnerResult:
+		cached.Status, resp = t.HTTPCode, t.Body
+	case server.RawResult:
+		resp = &t
+	case *server.StreamResult:
+		return
+	}
+
+	raw, isRaw := resp.(*server.RawResult)
+	if isRaw && raw.HTTPCode != 0 {
+		cached.Status = raw.HTTPCode
+	}
+	// only the successful responses are cached, the redirects and the error results are not
+	if cached.Status != 0 && (cached.Status < http.StatusOK || cached.Status >= http.StatusMultipleChoices) {
+		return
+	}
+
+	if isRaw {
+		if len(raw.Body) > policy.maxSize {
+			return
+		}
+		cached.ContentType, cached.Header, cached.Raw = raw.ContentType, raw.Header, raw.Body
+		if cached.ContentType == "" {
+			cached.ContentType = service.MIMEOctetStream
+		}
+	} else {
+		result, err := json.Marshal(resp)
+		if err != nil || len(result) > policy.maxSize {
+			return
+		}
+		cached.Result = result
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	p.cache.Set(key, data, policy.ttl)
+}
+
+// invalidate delete the cached responses of the api, or all the apis if empty
+func (p *httpServer) invalidate(apiName string) int {
+	if p.cache == nil {
+		return 0
+	}
+
+	prefix := ""
+	if apiName != "" {
+		prefix = cacheKeyPrefix(apiName)
+	}
+
+	deleted := p.cache.DeletePrefix(prefix)
+	p.options.Logger.Info("invalidate_cache", "api_name", apiName, "deleted", deleted)
+	return deleted
+}
+
+// invalidateCache DELETE invalidate_path?api=name
+func (p *httpServer) invalidateCache(gCtx *gin.Context) {
+	gCtx.JSON(http.StatusOK, gin.H{"deleted": p.invalidate(gCtx.Query("api"))})
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iTrellis/config"
+)
+
+// lruCache the in-memory response cache, which evicts the least recently used entries
+// when the number of entries exceeds max_entries, the expired entries are removed lazily
+type lruCache struct {
+	mu sync.Mutex
+
+	maxEntries int
+	ll         *list.List
+	entries    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+// NewLRUCache new in-memory lru cache, http.cache.max_entries default is 10000
+func NewLRUCache(conf config.Config) (ResponseCache, error) {
+	return newLRUCache(conf.GetInt("max_entries", 10000)), nil
+}
+
+func newLRUCache(maxEntries int) *lruCache {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &lruCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (p *lruCache) Get(key string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		p.remove(e)
+		return nil, false
+	}
+
+	p.ll.MoveToFront(e)
+	return entry.value, true
+}
+
+func (p *lruCache) Set(key string, value []byte, ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	expireAt := time.Now().Add(ttl)
+	if e, ok := p.entries[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.value, entry.expireAt = value, expireAt
+		p.ll.MoveToFront(e)
+		return
+	}
+
+	p.entries[key] = p.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for p.ll.Len() > p.maxEntries {
+		p.remove(p.ll.Back())
+	}
+}
+
+func (p *lruCache) DeletePrefix(prefix string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deleted := 0
+	for key, e := range p.entries {
+		if strings.HasPrefix(key, prefix) {
+			p.remove(e)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (p *lruCache) remove(e *list.Element) {
+	p.ll.Remove(e)
+	delete(p.entries, e.Value.(*lruEntry).key)
+}
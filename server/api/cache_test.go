@@ -0,0 +1,186 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/server/auth"
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+
+	c.Set(cacheKeyPrefix("a")+"1", []byte("a1"), time.Minute)
+	c.Set(cacheKeyPrefix("a")+"2", []byte("a2"), time.Minute)
+
+	_, ok := c.Get(cacheKeyPrefix("a") + "1")
+	testutils.Equals(t, true, ok)
+
+	// a2 is the least recently used
+	c.Set(cacheKeyPrefix("b")+"1", []byte("b1"), time.Minute)
+	_, ok = c.Get(cacheKeyPrefix("a") + "2")
+	testutils.Equals(t, false, ok)
+
+	c.Set(cacheKeyPrefix("b")+"2", []byte("b2"), -time.Second)
+	_, ok = c.Get(cacheKeyPrefix("b") + "2")
+	testutils.Equals(t, false, ok)
+
+	c.Set(cacheKeyPrefix("b")+"2", []byte("b2"), time.Minute)
+	testutils.Equals(t, 2, c.DeletePrefix(cacheKeyPrefix("b")))
+	testutils.Equals(t, 0, c.ll.Len())
+}
+
+func TestCachePolicy(t *testing.T) {
+	cp, err := newCachePolicy(&API{Name: "user.get"}, 10)
+	testutils.Ok(t, err)
+	testutils.Assert(t, cp == nil, "api without cache ttl should not be cached")
+
+	_, err = newCachePolicy(&API{Name: "user.get", CacheTTL: "1"}, 10)
+	testutils.NotOk(t, err)
+
+	cp, err = newCachePolicy(&API{Name: "user.get", CacheTTL: "30s", CacheHeaders: "Accept-Language"}, 10)
+	testutils.Ok(t, err)
+	testutils.Equals(t, 10, cp.maxSize)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1?fields=name", nil)
+	key := cp.key("user.get", "v1", req, nil, nil)
+	testutils.Equals(t, key, cp.key("user.get", "v1", httptest.NewRequest(http.MethodGet, "/users/1?fields=name", nil), nil, nil))
+
+	testutils.Assert(t, key != cp.key("user.get", "v1", req, []byte("{}"), nil), "body should be in key")
+	testutils.Assert(t, key != cp.key("user.get", "v1", req, nil, &auth.Principal{ID: "u1"}), "principal should be in key")
+
+	testutils.Assert(t, key != cp.key("user.get", "v2", req, nil, nil), "version should be in key")
+
+	req.Header.Set("Accept-Language", "en")
+	testutils.Assert(t, key != cp.key("user.get", "v1", req, nil, nil), "selected headers should be in key")
+}
+
+func TestStoreCached(t *testing.T) {
+	cp, err := newCachePolicy(&API{Name: "user.get", CacheTTL: "30s"}, 1024)
+	testutils.Ok(t, err)
+	p := &httpServer{cache: newLRUCache(10)}
+
+	for key, resp := range map[string]interface{}{
+		"error":    &InnerResult{HTTPCode: http.StatusNotFound, Body: "not found"},
+		"redirect": &InnerResult{HTTPCode: http.StatusFound, RedirectURL: "/login"},
+		"raw":      &server.RawResult{HTTPCode: http.StatusServiceUnavailable, Body: []byte("busy")},
+	} {
+		p.storeCached(cp, key, resp)
+		_, ok := p.cache.Get(key)
+		testutils.Assert(t, !ok, "%s result should not be cached", key)
+	}
+
+	for key, resp := range map[string]interface{}{
+		"result": map[string]string{"name": "trellis"},
+		"inner":  &InnerResult{HTTPCode: http.StatusOK, Body: "ok"},
+		"raw":    &server.RawResult{Body: []byte("ok")},
+	} {
+		p.storeCached(cp, key, resp)
+		_, ok := p.cache.Get(key)
+		testutils.Assert(t, ok, "%s result should be cached", key)
+	}
+}
+
+// versionCaller returns the version of the called service
+type versionCaller struct{ calls int }
+
+func (p *versionCaller) CallComponent(msg message.Message) (interface{}, error) {
+	p.calls++
+	return msg.Service().GetVersion(), nil
+}
+
+func TestCachedSplitAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api := &API{Name: "user.get", ServiceName: "user", ServiceVersion: "v1",
+		Versions: "v1:100", Rules: "X-Canary=true:v2", CacheTTL: "30s"}
+	ts, err := newTrafficSplit(api)
+	testutils.Ok(t, err)
+	cp, err := newCachePolicy(api, 1024)
+	testutils.Ok(t, err)
+
+	caller := &versionCaller{}
+	gw := &gateway.Gateway{Namespace: "trellis/api/v1"}
+	p := &httpServer{
+		gateway: gw,
+		pipeline: &Pipeline{
+			gateway: gw,
+			apis:    map[string]*API{api.Name: api},
+			splits:  map[string]*trafficSplit{api.Name: ts},
+		},
+		cache:         newLRUCache(10),
+		cachePolicies: map[string]*cachePolicy{api.Name: cp},
+		options:       component.Options{Caller: caller},
+	}
+
+	call := func(canary bool) (string, string) {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1", nil)
+		if canary {
+			ctx.Request.Header.Set("X-Canary", "true")
+		}
+		p.serveAPI(ctx, api.Name, api, true, nil)
+
+		r := &server.Response{}
+		testutils.Ok(t, json.Unmarshal(w.Body.Bytes(), r))
+		return fmt.Sprint(r.Result), w.Header().Get(HeaderXCache)
+	}
+
+	version, cache := call(false)
+	testutils.Equals(t, "v1", version)
+	testutils.Equals(t, "MISS", cache)
+
+	// the cached response of v1 is not served to the requests split to v2
+	version, cache = call(true)
+	testutils.Equals(t, "v2", version)
+	testutils.Equals(t, "MISS", cache)
+
+	version, cache = call(false)
+	testutils.Equals(t, "v1", version)
+	testutils.Equals(t, "HIT", cache)
+
+	version, cache = call(true)
+	testutils.Equals(t, "v2", version)
+	testutils.Equals(t, "HIT", cache)
+	testutils.Equals(t, 2, caller.calls)
+}
+
+func TestParseCacheControl(t *testing.T) {
+	cc := parseCacheControl("")
+	testutils.Equals(t, cacheControl{maxAge: -1}, cc)
+
+	cc = parseCacheControl("No-Cache, max-age=10")
+	testutils.Equals(t, cacheControl{noCache: true, maxAge: 10}, cc)
+
+	cc = parseCacheControl("no-store")
+	testutils.Equals(t, true, cc.noStore)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/config"
+	"github.com/urfave/cli/v2"
+
+	"github.com/iTrellis/trellis/cmd"
+	"github.com/iTrellis/trellis/configure"
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+func init() {
+	cmd.RegisterCommand(newOpenAPICommand)
+}
+
+// newOpenAPICommand the command writing the openapi document of the apis loaded by the api server's store,
+// the schemas of the components' topics are not included, because the components are not running
+func newOpenAPICommand(c cmd.Cmd) *cli.Command {
+	return &cli.Command{
+		Name:  "openapi",
+		Usage: "write the openapi document of the api server",
+		Action: func(ctx *cli.Context) error {
+			if err := c.Init(cmd.ConfigFile(ctx.String("config"))); err != nil {
+				return err
+			}
+			if c.Config() == nil {
+				return fmt.Errorf("config file is required")
+			}
+			return writeOpenAPI(c.Config(), c.Logger(), ctx.String("service"), ctx.String("output"))
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "config file",
+			},
+			&cli.StringFlag{
+				Name:  "service",
+				Usage: "key of the api server in project.services, default is the first " + apiService.Name,
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "output file, - for stdout",
+				Value: "openapi.json",
+			},
+		},
+	}
+}
+
+func writeOpenAPI(conf config.Config, l logger.Logger, serviceKey, output string) error {
+	services := make(map[string]*configure.Service)
+	if err := conf.ToObject("project.services", &services); err != nil {
+		return err
+	}
+
+	if serviceKey == "" {
+		keys := make([]string, 0, len(services))
+		for key := range services {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if services[key].Name == apiService.Name {
+				serviceKey = key
+				break
+			}
+		}
+	}
+
+	serviceConf, ok := services[serviceKey]
+	if !ok {
+		return fmt.Errorf("api server not found in project.services: %s", serviceKey)
+	}
+
+	opts := serviceConf.Options.ToConfig()
+	store, err := NewAPIStore(opts.GetValuesConfig("apis"),
+		component.Options{Config: opts, Logger: l, ProjectConfig: conf})
+	if err != nil {
+		return err
+	}
+	defer store.Stop()
+
+	apis, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	info := OpenAPIInfo{
+		Title:   opts.GetString("http.openapi.title", "trellis api"),
+		Version: opts.GetString("http.openapi.version", "v1"),
+	}
+
+	mode, err := gateway.ParseResponseMode(opts.GetString("http.response_mode"))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(NewOpenAPI(info, opts.GetString("http.postapi"), mode, apis), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
@@ -18,9 +18,9 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package api
 
 import (
-	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"sync"
@@ -28,82 +28,64 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iTrellis/common/errors"
-	"github.com/iTrellis/common/formats"
-	"github.com/iTrellis/xorm_ext"
-	"xorm.io/xorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 
 	"github.com/iTrellis/trellis/cmd"
 	"github.com/iTrellis/trellis/internal/addr"
-	"github.com/iTrellis/trellis/internal/gin_middlewares"
+	"github.com/iTrellis/trellis/internal/metrics"
+	"github.com/iTrellis/trellis/internal/tracing"
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/server/auth"
+	"github.com/iTrellis/trellis/server/gateway"
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/component"
 	"github.com/iTrellis/trellis/service/message"
 )
 
-func init() {
-	cmd.DefaultCompManager.RegisterComponentFunc(
-		&service.Service{Name: "trellis-postapi", Version: "v1"},
-		NewHTTPServer,
-	)
-}
-
-var handlers = make(map[string]*gin_middlewares.Handler)
+var apiService = &service.Service{Name: "trellis-postapi", Version: "v1"}
 
-// RegistCustomHandlers register customer's handlers
-func RegistCustomHandlers(name, path, method string, fn gin.HandlerFunc) {
-
-	if fn == nil {
-		panic("handler function should not be nil")
-	}
-	_, ok := handlers[name]
-	if ok {
-		panic(fmt.Errorf("handler isalread exists"))
-	}
-
-	handlers[name] = &gin_middlewares.Handler{Name: name, URLPath: path, Method: strings.ToUpper(method), Func: fn}
+func init() {
+	cmd.DefaultCompManager.RegisterComponentFunc(apiService, NewHTTPServer)
 }
 
 type httpServer struct {
-	ginMode string
+	gateway *gateway.Gateway
 
 	mode string // LOCAL, REMOTE
 
 	forwardHeaders []string
 
-	apis map[string]*API
+	// pipeline the rate limits, auth, schemas and traffic splits of the apis, shared with the other gateways
+	pipeline *Pipeline
+	// http routes of the apis which declare path
+	routes routes
+	// cache the cache of the responses, nil if disabled
+	cache         ResponseCache
+	cacheMaxSize  int
+	cachePolicies map[string]*cachePolicy
+
+	// postPath the path of the apis called by X-Api header
+	postPath    string
+	openAPIInfo OpenAPIInfo
 
 	options component.Options
 
-	srv *http.Server
+	store  APIStore
+	syncer sync.RWMutex
 
-	ticker    *time.Ticker
-	syncer    sync.RWMutex
-	apiEngine *xorm.Engine
+	// readyAfterLoaded the server is not ready until the apis are loaded,
+	// and it could be started even if the store fails to load the apis
+	readyAfterLoaded bool
 }
 
-// Response response
-type Response struct {
-	TraceID   string      `json:"trace_id"`
-	TraceIP   string      `json:"trace_ip"`
-	Code      uint64      `json:"code"`
-	Namespace string      `json:"namespace,omitempty"`
-	Msg       string      `json:"msg,omitempty"`
-	Result    interface{} `json:"result"`
-}
-
-// InnerResult result of running component
-type InnerResult struct {
-	HTTPCode    int
-	RedirectURL string
-	Body        interface{}
-}
+// InnerResult result of running component, see server.InnerResult
+type InnerResult = server.InnerResult
 
 // NewHTTPServer new api service
 func NewHTTPServer(opts ...component.Option) (component.Component, error) {
 
-	s := &httpServer{
-		apis: make(map[string]*API),
-	}
+	s := &httpServer{}
 
 	for _, o := range opts {
 		o(&s.options)
@@ -120,191 +102,262 @@ func NewHTTPServer(opts ...component.Option) (component.Component, error) {
 func (p *httpServer) init() error {
 
 	p.mode = p.options.Config.GetString("mode")
-	p.ginMode = p.options.Config.GetString("gin_mode")
-
-	gin.SetMode(p.ginMode)
-
-	apisConf := p.options.Config.GetValuesConfig("apis")
 
-	typ := apisConf.GetString("type", "file")
-	switch typ {
-	case "file":
-		apis := apisConf.GetValuesConfig(typ)
-
-		for _, apiKey := range apis.GetKeys() {
-			apiConf := apisConf.GetValuesConfig("file." + apiKey)
-			if apiConf == nil {
-				return fmt.Errorf("init api failed: %s", apiKey)
-			}
-
-			api := &API{
-				Name:           apiConf.GetString("api"),
-				Topic:          apiConf.GetString("topic"),
-				ServiceDomain:  apiConf.GetString("service_domain"),
-				ServiceName:    apiConf.GetString("service_name"),
-				ServiceVersion: apiConf.GetString("service_version"),
-			}
+	gw, err := gateway.New(apiService.TrellisPath(), p.options)
+	if err != nil {
+		return err
+	}
+	p.gateway = gw
 
-			p.apis[api.Name] = api
-		}
-	case "mysql":
+	pipeline, err := NewPipeline(gw, p.options.Logger)
+	if err != nil {
+		return err
+	}
+	p.pipeline = pipeline
 
-		databaseConf := apisConf.GetValuesConfig(typ)
+	httpConf := gw.Conf
 
-		engines, err := xorm_ext.NewEnginesFromConfig(databaseConf)
+	// the cache is initialized before the apis are loaded, which are parsed with the cache config
+	if cacheConf := httpConf.GetValuesConfig("cache"); cacheConf != nil && cacheConf.GetBoolean("enabled", false) {
+		cache, err := NewResponseCache(cacheConf)
 		if err != nil {
 			return err
 		}
-		p.apiEngine = engines[xorm_ext.DefaultDatabase]
-
-		ticker := formats.ParseStringTime(apisConf.GetString("ticker", "30s"))
-
-		p.ticker = time.NewTicker(ticker)
-
-		s := &service.Service{
-			Domain:  apisConf.GetString("service_domain"),
-			Name:    apisConf.GetString("service_name"),
-			Version: apisConf.GetString("service_version"),
-		}
-		go p.syncAPIs(s)
-	default:
-		return fmt.Errorf("unknown apis' config type")
+		p.cache = cache
+		p.cacheMaxSize = cacheConf.GetInt("max_size", 1<<20)
 	}
 
-	engine := gin.New()
-
-	engine.Use(gin.Recovery(), gin_middlewares.NewRequestID(), gin_middlewares.StatFunc(p.options.Logger))
-
-	httpConf := p.options.Config.GetValuesConfig("http")
-
-	staticPath := httpConf.GetString("static_path")
-	staticRedirect := httpConf.GetString("static_redirect")
-	staticRoot := httpConf.GetString("static_root", "./root")
-	if staticPath != "" {
-		if staticRedirect != "" {
-			engine.GET(staticPath, func(c *gin.Context) {
-				c.Redirect(http.StatusFound, staticRedirect)
-			})
+	apisConf := p.options.Config.GetValuesConfig("apis")
 
-			engine.Static(staticRedirect, staticRoot)
-		} else {
-			engine.Static(staticPath, staticRoot)
-		}
+	store, err := NewAPIStore(apisConf, p.options)
+	if err != nil {
+		return err
 	}
 
-	gin_middlewares.LoadPprof(engine, httpConf.GetValuesConfig("pprof"))
+	p.readyAfterLoaded = apisConf.GetBoolean("ready_after_loaded", false)
 
-	ginHanlders := []gin.HandlerFunc{}
-
-	if gzipH := gin_middlewares.LoadGZip(httpConf.GetValuesConfig("gzip")); gzipH != nil {
-		ginHanlders = append(ginHanlders, gzipH)
+	apis, err := store.Load()
+	switch {
+	case err == nil:
+		p.setAPIs(apis)
+	case p.readyAfterLoaded:
+		p.options.Logger.Error("load_apis_failed", "err", err.Error())
+	default:
+		store.Stop()
+		return err
 	}
 
-	if corsH := gin_middlewares.LoadCors(httpConf.GetValuesConfig("cors")); corsH != nil {
-		ginHanlders = append(ginHanlders, corsH)
-	}
+	p.store = store
 
-	for _, name := range gin_middlewares.IndexGinFuncs {
-		ginHanlders = append(ginHanlders, gin_middlewares.UseFuncs[name])
-	}
-	engine.Use(ginHanlders...)
+	engine := gw.Engine
 
 	urlPath := httpConf.GetString("postapi")
 	if len(urlPath) != 0 {
 		engine.POST(urlPath, p.serve)
 	}
+	p.postPath = urlPath
 
-	for _, v := range handlers {
-		p.options.Logger.Info("start_customer_handler", "name", v.Name, "path", v.URLPath, "method", v.Method)
-		engine.Handle(v.Method, v.URLPath, v.Func)
+	if openAPIConf := httpConf.GetValuesConfig("openapi"); openAPIConf != nil && openAPIConf.GetBoolean("enabled", false) {
+		p.openAPIInfo = OpenAPIInfo{
+			Title:   openAPIConf.GetString("title", "trellis api"),
+			Version: openAPIConf.GetString("version", "v1"),
+		}
+		engine.GET(openAPIConf.GetString("path", "/openapi.json"), p.openAPI)
 	}
 
-	p.forwardHeaders = httpConf.GetStringList("forward.headers")
+	// apis declared with method & path are matched by the routes
+	engine.NoRoute(p.serveRoute)
+
+	if healthConf := httpConf.GetValuesConfig("health"); healthConf != nil && healthConf.GetBoolean("enabled", false) {
+		engine.GET(healthConf.GetString("path", "/health"), p.health)
+		engine.GET(healthConf.GetString("ready_path", "/ready"), p.ready)
+	}
 
-	p.srv = &http.Server{
-		Addr:    httpConf.GetString("address", ":8080"),
-		Handler: engine,
+	if p.cache != nil {
+		if path := httpConf.GetString("cache.invalidate_path"); path != "" {
+			handlers := []gin.HandlerFunc{}
+			if authorization := httpConf.GetString("cache.authorization"); authorization != "" {
+				handlers = append(handlers, func(c *gin.Context) {
+					if subtle.ConstantTimeCompare([]byte(c.Request.Header.Get("Authorization")), []byte(authorization)) != 1 {
+						c.AbortWithStatus(http.StatusForbidden)
+						return
+					}
+					c.Next()
+				})
+			}
+			engine.DELETE(path, append(handlers, p.invalidateCache)...)
+		}
 	}
 
+	p.forwardHeaders = httpConf.GetStringList("forward.headers")
+
 	return nil
 }
 
-func (p *httpServer) Route(message.Message) (interface{}, error) {
+// TopicInvalidateCache the topic to invalidate the cached responses, request is InvalidateCacheRequest
+const TopicInvalidateCache = "invalidate_cache"
+
+// InvalidateCacheRequest invalidate the cached responses of the api, all the apis if api is empty
+type InvalidateCacheRequest struct {
+	API string `json:"api"`
+}
+
+func (p *httpServer) Route(msg message.Message) (interface{}, error) {
+	switch msg.Topic() {
+	case TopicInvalidateCache:
+		req := InvalidateCacheRequest{}
+		if len(msg.GetPayload().GetBody()) != 0 {
+			if err := msg.ToObject(&req); err != nil {
+				return nil, p.gateway.NewError(message.ErrCodeBadRequest, fmt.Sprintf("bad request: %s", err.Error()))
+			}
+		}
+		return p.invalidate(req.API), nil
+	}
 	return nil, nil
 }
 
 func (p *httpServer) Start() error {
 
-	go func() {
-
-		var err error
-
-		sslConf := p.options.Config.GetValuesConfig("http.ssl")
+	p.checkAPITopics()
 
-		if sslConf != nil && sslConf.GetBoolean("enabled", false) {
-			err = p.srv.ListenAndServeTLS(
-				sslConf.GetString("cert-file"),
-				sslConf.GetString("cert-key"),
-			)
-		} else {
-			err = p.srv.ListenAndServe()
-		}
+	// the changes of apis are watched until the server is stopped
+	p.store.Watch(p.setAPIs)
 
-		if err != nil {
-			if err != http.ErrServerClosed {
-				p.options.Logger.Error("failed_listen_and_serve", "err", err.Error())
-				log.Fatalln(err)
-			}
-		}
-	}()
-	return nil
+	return p.gateway.Start()
 }
 
+// Stop stop both the gateway and the api store, the errors are combined
 func (p *httpServer) Stop() error {
+	var errs []string
+	if err := p.gateway.Stop(); err != nil {
+		errs = append(errs, fmt.Sprintf("gateway stop failure, err: %s", err))
+	}
 
-	dur := p.options.Config.GetTimeDuration("http.shutdown-timeout", time.Second*30)
-
-	ctx, cancel := context.WithTimeout(context.Background(), dur)
-	defer cancel()
+	if err := p.store.Stop(); err != nil {
+		errs = append(errs, fmt.Sprintf("api store stop failure, err: %s", err))
+	}
 
-	if err := p.srv.Shutdown(ctx); err != nil {
-		return errors.Newf("api shutdown failure, err: %s", err)
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
 	return nil
 }
 
 func (p *httpServer) serve(gCtx *gin.Context) {
-
 	apiName := gCtx.Request.Header.Get(service.HeaderXAPI)
+	api, ok := p.pipeline.GetAPI(apiName)
+	p.serveAPI(gCtx, apiName, api, ok, nil)
+}
+
+// serveRoute serve the apis by the http method & path
+func (p *httpServer) serveRoute(gCtx *gin.Context) {
+	p.syncer.RLock()
+	api, params, ok := p.routes.match(gCtx.Request.Method, gCtx.Request.URL.Path)
+	p.syncer.RUnlock()
+	if !ok {
+		p.gateway.Error(gCtx, p.gateway.NewResponse(gCtx),
+			p.gateway.NewError(message.ErrCodeAPINotFound, "api not found"))
+		return
+	}
+	p.serveAPI(gCtx, api.Name, api, true, params)
+}
+
+func (p *httpServer) serveAPI(gCtx *gin.Context, apiName string, api *API, ok bool, params map[string]string) {
+
 	clientIP := addr.GetClientIP(gCtx.Request)
 
 	reqID := gCtx.GetHeader(service.HeaderXRequestID)
 
-	r := &Response{
-		TraceID: reqID,
-		TraceIP: addr.ExternalIPs()[0],
+	r := p.gateway.NewResponse(gCtx)
+
+	apiLabel := apiName
+	if !ok {
+		apiLabel = metrics.UnknownAPI
 	}
 
-	api, ok := p.getAPI(apiName)
+	var msgService *service.Service
+	ctx, span := tracing.StartFromHTTP(gCtx.Request, "trellis.api "+apiLabel,
+		attribute.String("trellis.api", apiName), attribute.String("trellis.request_id", reqID))
+	defer func(begin time.Time) {
+		metrics.ServerRequest(p.options.Instance, apiLabel, msgService, r.Code, begin)
+		if r.Code != 0 {
+			span.SetStatus(codes.Error, r.Msg)
+		}
+		span.End()
+	}(time.Now())
+
 	if !ok {
-		r.Code = 11
-		r.Msg = "api not found"
-		r.Namespace = "trellis"
-		gCtx.JSON(http.StatusBadRequest, r)
+		p.gateway.Error(gCtx, r, p.gateway.NewError(message.ErrCodeAPINotFound, "api not found"))
 		p.options.Logger.Error("api_not_found", "request_id", reqID, "api_name", apiName, "client_ip", clientIP)
 		return
 	}
 
-	body, err := gCtx.GetRawData()
+	mode := api.Mode()
+
+	if err := p.pipeline.Allow(api, clientIP, gCtx.Request.Header); err != nil {
+		p.gateway.ErrorAs(gCtx, mode, r, err)
+		p.options.Logger.Warn("rate_limited", "request_id", reqID, "api_name", apiName,
+			"client_ip", clientIP, "err", err.Error())
+		return
+	}
+
+	principal, err := p.authenticate(gCtx.Request, api)
 	if err != nil {
-		r.Code = 10
-		r.Msg = fmt.Sprintf("bad request: %s", err.Error())
-		r.Namespace = "trellis"
-		gCtx.JSON(http.StatusBadRequest, r)
-		p.options.Logger.Error("get_raw_data", "request_id", r.TraceID, "api_name", apiName, "client_ip", clientIP, "err", err)
+		p.gateway.ErrorAs(gCtx, mode, r, err)
+		p.options.Logger.Warn("auth_failed", "request_id", reqID, "api_name", apiName,
+			"client_ip", clientIP, "err", err.Error())
+		return
+	}
+
+	if err := p.gateway.LimitBody(gCtx, api.MaxBodySize); err != nil {
+		p.gateway.ErrorAs(gCtx, mode, r, err)
+		p.options.Logger.Warn("request_too_large", "request_id", reqID, "api_name", apiName, "client_ip", clientIP)
 		return
 	}
 
+	// the uploads are streamed to the component, the other bodies are buffered to be validated, signed and cached
+	streamed := gateway.IsStreamBody(gCtx.GetHeader(service.HeaderContentType))
+	if streamed && principal != nil && auth.Signed(gCtx.Request) {
+		// the body digest of the signed request could not be verified before the component reads the body
+		err := p.gateway.NewError(message.ErrCodeUnauthorized, "unauthorized: body of signed request could not be streamed")
+		p.gateway.ErrorAs(gCtx, mode, r, err)
+		p.options.Logger.Warn("auth_failed", "request_id", reqID, "api_name", apiName,
+			"client_ip", clientIP, "err", err.Error())
+		return
+	}
+
+	var body []byte
+	if !streamed {
+		var err error
+		body, err = gCtx.GetRawData()
+		if err != nil {
+			if _, ok := err.(*message.Error); !ok {
+				err = p.gateway.NewError(message.ErrCodeBadRequest, fmt.Sprintf("bad request: %s", err.Error()))
+			}
+			p.gateway.ErrorAs(gCtx, mode, r, err)
+			p.options.Logger.Error("get_raw_data", "request_id", reqID, "api_name", apiName, "client_ip", clientIP, "err", err)
+			return
+		}
+
+		// the body digest is signed by the hmac requests
+		if err := auth.VerifyBodyDigest(gCtx.Request, body); err != nil {
+			p.gateway.ErrorAs(gCtx, mode, r, p.gateway.NewError(message.ErrCodeUnauthorized,
+				fmt.Sprintf("unauthorized: %s", err.Error())))
+			p.options.Logger.Warn("auth_failed", "request_id", reqID, "api_name", apiName,
+				"client_ip", clientIP, "err", err.Error())
+			return
+		}
+	}
+
+	if !streamed {
+		if err := p.pipeline.ValidateRequest(api, body); err != nil {
+			p.gateway.ErrorAs(gCtx, mode, r, err)
+			p.options.Logger.Warn("invalid_request", "request_id", reqID, "api_name", apiName,
+				"client_ip", clientIP, "err", err.Error())
+			return
+		}
+	}
+
 	payload := &message.Payload{
 		Header: make(map[string]string),
 		Body:   body,
@@ -312,73 +365,174 @@ func (p *httpServer) serve(gCtx *gin.Context) {
 
 	payload.Set(service.HeaderXClientIP, clientIP)
 	payload.Set(service.HeaderXRequestID, reqID)
+	if streamed {
+		// the boundary of the multipart body
+		payload.Set(service.HeaderContentType, gCtx.GetHeader(service.HeaderContentType))
+	}
 	for _, h := range p.forwardHeaders {
 		payload.Set(h, gCtx.GetHeader(h))
 	}
+	for _, h := range api.HeaderList() {
+		payload.Set(h, gCtx.GetHeader(h))
+	}
+	for k, v := range params {
+		payload.Set(message.PathParamPrefix+k, v)
+	}
+	for k, vs := range gCtx.Request.URL.Query() {
+		payload.Set(message.QueryParamPrefix+k, strings.Join(vs, ","))
+	}
+	tracing.Inject(ctx, payload)
+	principal.SetPayload(payload)
+
+	// the version is picked before the cache, so that the responses of the split versions are cached separately
+	msgService = &service.Service{
+		Domain:  api.ServiceDomain,
+		Name:    api.ServiceName,
+		Version: p.pipeline.ServiceVersion(api, gCtx.Request.Header),
+		Topic:   api.Topic}
+	span.SetAttributes(attribute.String("trellis.service_version", msgService.Version))
+
+	p.syncer.RLock()
+	policy := p.cachePolicies[api.Name]
+	p.syncer.RUnlock()
+
+	var cacheKey string
+	cc := parseCacheControl(gCtx.GetHeader("Cache-Control"))
+	if p.cache != nil && policy != nil && !cc.noStore && !streamed {
+		cacheKey = policy.key(api.Name, msgService.Version, gCtx.Request, body, principal)
+		if !cc.noCache && p.serveCached(gCtx, mode, r, cacheKey, cc.maxAge) {
+			return
+		}
+		gCtx.Header(HeaderXCache, "MISS")
+	}
 
-	msg := message.NewMessage(message.Service(
-		&service.Service{
-			Domain:  api.ServiceDomain,
-			Name:    api.ServiceName,
-			Version: api.ServiceVersion,
-			Topic:   api.Topic}),
-		message.MessagePayload(payload),
-	)
+	msgOpts := []message.Option{message.Service(msgService), message.MessagePayload(payload)}
+	if streamed {
+		msgOpts = append(msgOpts, message.BodyReader(gCtx.Request.Body))
+	}
+	msg := message.NewMessage(msgOpts...)
 
 	resp, err := p.options.Caller.CallComponent(msg)
 	if err == nil {
-		r.reponse(gCtx, resp)
+		err = p.pipeline.ValidateResponse(api, resp)
+	}
+	if err == nil {
+		if cacheKey != "" {
+			p.storeCached(policy, cacheKey, resp)
+		}
+		p.gateway.ReplyAs(gCtx, mode, r, resp)
 		return
 	}
 
-	// errors
-	switch et := err.(type) {
-	case errors.ErrorCode:
-		r.Code = et.Code()
-		r.Msg = et.Error()
-		r.Namespace = et.Namespace()
-	case errors.SimpleError:
-		r.Code = 14
-		r.Msg = et.Error()
-		r.Namespace = et.Namespace()
-	default:
-		r.Code = 15
-		r.Msg = et.Error()
-		r.Namespace = "trellis"
+	p.gateway.ErrorAs(gCtx, mode, r, err)
+
+	p.options.Logger.Error("call_server_failed", "request_id", reqID, "api_name", apiName, "client_ip", clientIP, "err", r)
+}
+
+// authenticate the caller and authorize by the roles of the api
+func (p *httpServer) authenticate(req *http.Request, api *API) (*auth.Principal, error) {
+	principal, err := p.pipeline.Authenticate(req)
+	if err != nil {
+		return nil, err
 	}
 
-	p.options.Logger.Error("call_server_failed", "request_id", r.TraceID, "api_name", apiName, "client_ip", clientIP, "err", r)
-	gCtx.JSON(200, r)
+	if err := p.pipeline.Authorize(principal, api); err != nil {
+		return nil, err
+	}
+	return principal, nil
 }
 
-func (p *httpServer) getAPI(name string) (*API, bool) {
-	p.syncer.RLock()
-	api, ok := p.apis[name]
-	p.syncer.RUnlock()
-	return api, ok
+// checkAPITopics warn the apis whose topic is not registered in the local component
+func (p *httpServer) checkAPITopics() {
+	if p.options.CompManager == nil {
+		return
+	}
+
+	for _, api := range p.pipeline.APIs() {
+		cpt, err := p.options.CompManager.GetComponent(&service.Service{
+			Domain: api.ServiceDomain, Name: api.ServiceName, Version: api.ServiceVersion})
+		if err != nil {
+			continue
+		}
+
+		lister, ok := cpt.(component.TopicLister)
+		if !ok {
+			continue
+		}
+
+		found := false
+		for _, t := range lister.ListTopics() {
+			if t.Name == api.Topic {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			p.options.Logger.Warn("api_topic_not_found", "api_name", api.Name, "topic", api.Topic,
+				"service", api.ServiceName, "version", api.ServiceVersion)
+		}
+	}
 }
 
-func (p *Response) reponse(ctx *gin.Context, resp interface{}) {
+// validateResponse validate the result of the response, which would be the body of InnerResult or RawResult
+func validateResponse(v schemaValidator, resp interface{}) error {
+	var body []byte
 	switch t := resp.(type) {
+	case *server.StreamResult:
+		// the chunks are not validated
+		return nil
 	case InnerResult:
-		p.genResult(ctx, &t)
-		return
+		resp = t.Body
 	case *InnerResult:
-		p.genResult(ctx, t)
-		return
-	default:
-		p.Result = resp
-		ctx.JSON(200, p)
-		return
+		resp = t.Body
+	case server.RawResult:
+		body = t.Body
+	case *server.RawResult:
+		body = t.Body
+	}
+
+	if body == nil {
+		var err error
+		if body, err = json.Marshal(resp); err != nil {
+			return err
+		}
+	}
+
+	errs := v.validate(body)
+	if errs == nil {
+		return nil
 	}
+
+	vErr := message.NewError(message.ErrCodeInvalidResponse, apiService.TrellisPath(), "invalid response body")
+	for field, msg := range errs {
+		vErr.SetDetail(field, msg)
+	}
+	return vErr
 }
 
-func (p *Response) genResult(ctx *gin.Context, t *InnerResult) {
-	switch t.HTTPCode {
-	case http.StatusMovedPermanently, http.StatusFound:
-		ctx.Redirect(t.HTTPCode, t.RedirectURL)
-	default:
-		p.Result = t.Body
-		ctx.JSON(t.HTTPCode, p)
+type healthStatus struct {
+	Status string     `json:"status"`
+	APIs   int        `json:"apis"`
+	Store  SyncStatus `json:"store"`
+}
+
+func (p *httpServer) healthStatus() *healthStatus {
+	return &healthStatus{Status: "ok", APIs: len(p.pipeline.APIs()), Store: p.store.Status()}
+}
+
+// health the server is alive, with the sync status of the apis
+func (p *httpServer) health(gCtx *gin.Context) {
+	gCtx.JSON(http.StatusOK, p.healthStatus())
+}
+
+// ready the server is not ready if ready_after_loaded and the apis have never been loaded
+func (p *httpServer) ready(gCtx *gin.Context) {
+	hs := p.healthStatus()
+	if p.readyAfterLoaded && hs.Store.LastSync.IsZero() {
+		hs.Status = "not_ready"
+		gCtx.JSON(http.StatusServiceUnavailable, hs)
+		return
 	}
+	gCtx.JSON(http.StatusOK, hs)
 }
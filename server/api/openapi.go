@@ -0,0 +1,529 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+// maxSchemaDepth the nested types deeper than it are described as any value
+const maxSchemaDepth = 8
+
+// OpenAPI the openapi 3 document of the apis
+type OpenAPI struct {
+	OpenAPI string                                  `json:"openapi"`
+	Info    OpenAPIInfo                             `json:"info"`
+	Paths   map[string]map[string]*OpenAPIOperation `json:"paths"`
+}
+
+// OpenAPIInfo info of the document
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIOperation the operation of an api
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+
+	// Anonymous & Roles the authorization of the api when auth is enabled
+	Anonymous bool     `json:"x-trellis-anonymous,omitempty"`
+	Roles     []string `json:"x-trellis-roles,omitempty"`
+
+	// Service the target service of the api
+	Service *OpenAPIService `json:"x-trellis-service,omitempty"`
+
+	// APIs the operations of the apis called by X-Api header, keyed by api name
+	APIs map[string]*OpenAPIOperation `json:"x-trellis-apis,omitempty"`
+}
+
+// OpenAPIService the target service of the api
+type OpenAPIService struct {
+	Domain   string   `json:"domain,omitempty"`
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Topic    string   `json:"topic"`
+	Versions []string `json:"versions,omitempty"`
+	Rules    []string `json:"rules,omitempty"`
+}
+
+// OpenAPIParameter the parameter of the operation
+type OpenAPIParameter struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required,omitempty"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+// OpenAPIBody the request body of the operation
+type OpenAPIBody struct {
+	Description string                       `json:"description,omitempty"`
+	Required    bool                         `json:"required,omitempty"`
+	Content     map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse the response of the operation
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType the schema of the content
+type OpenAPIMediaType struct {
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// topicLookup returns the topic of the api's component, nil if not found
+type topicLookup func(api *API) *component.Topic
+
+// NewOpenAPI generate the openapi document of the apis, postPath is the path of the apis called by X-Api header.
+// OpenAPI has one operation per path and method, so the apis called by X-Api header share one POST operation
+// of postPath, whose X-Api parameter enumerates the api names, and the operations of the apis are described
+// in the extension x-trellis-apis keyed by api name, mode is the default response mode of the apis
+func NewOpenAPI(info OpenAPIInfo, postPath string, mode gateway.ResponseMode, apis map[string]*API) *OpenAPI {
+	return newOpenAPI(info, postPath, mode, apis, nil)
+}
+
+func newOpenAPI(info OpenAPIInfo, postPath string, mode gateway.ResponseMode,
+	apis map[string]*API, lookup topicLookup) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+
+	names := make([]string, 0, len(apis))
+	for name := range apis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var postOp *OpenAPIOperation
+	if postPath != "" && len(names) != 0 {
+		postOp = newPostOperation(names, mode)
+		doc.addOperation(postPath, http.MethodPost, postOp)
+	}
+
+	for _, name := range names {
+		api := apis[name]
+
+		var topic *component.Topic
+		if lookup != nil {
+			topic = lookup(api)
+		}
+
+		apiMode := api.Mode()
+		if apiMode == "" {
+			apiMode = mode
+		}
+
+		if api.Path != "" {
+			method := api.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			op := newOpenAPIOperation(api, topic, apiMode)
+			path := openAPIPath(api.Path, op)
+			doc.addOperation(path, method, op)
+		}
+
+		if postOp != nil {
+			postOp.APIs[api.Name] = newOpenAPIOperation(api, topic, apiMode)
+		}
+	}
+	return doc
+}
+
+// newPostOperation the operation of the apis called by X-Api header
+func newPostOperation(names []string, mode gateway.ResponseMode) *OpenAPIOperation {
+	return &OpenAPIOperation{
+		OperationID: "call_api",
+		Summary:     "call the api named by X-Api header",
+		Parameters: []*OpenAPIParameter{{
+			Name: service.HeaderXAPI, In: "header", Required: true,
+			Schema: map[string]interface{}{"type": "string", "enum": names},
+		}},
+		RequestBody: &OpenAPIBody{
+			Description: "the request of the api, see x-trellis-apis",
+			Content: map[string]*OpenAPIMediaType{
+				service.MIMEApplicationJSON: {Schema: map[string]interface{}{}},
+			},
+		},
+		Responses: openAPIResponses(map[string]interface{}{}, mode),
+		APIs:      make(map[string]*OpenAPIOperation, len(names)),
+	}
+}
+
+func (p *OpenAPI) addOperation(path, method string, op *OpenAPIOperation) {
+	ops, ok := p.Paths[path]
+	if !ok {
+		ops = make(map[string]*OpenAPIOperation)
+		p.Paths[path] = ops
+	}
+	ops[strings.ToLower(method)] = op
+}
+
+// openAPIPath convert the route path into openapi path, and add the path parameters into operation
+func openAPIPath(path string, op *OpenAPIOperation) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, seg := range segments {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		name := seg[1:]
+		segments[i] = "{" + name + "}"
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name: name, In: "path", Required: true, Schema: map[string]interface{}{"type": "string"},
+		})
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func newOpenAPIOperation(api *API, topic *component.Topic, mode gateway.ResponseMode) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		OperationID: api.Name,
+		Summary:     api.Topic,
+		Tags:        []string{api.ServiceName},
+		Service: &OpenAPIService{
+			Domain:   api.ServiceDomain,
+			Name:     api.ServiceName,
+			Version:  api.ServiceVersion,
+			Topic:    api.Topic,
+			Versions: api.VersionList(),
+			Rules:    api.RuleList(),
+		},
+	}
+
+	for _, h := range api.HeaderList() {
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name: h, In: "header", Schema: map[string]interface{}{"type": "string"},
+		})
+	}
+
+	op.Anonymous, op.Roles = api.Anonymous, api.RoleList()
+
+	reqSchema := declaredSchema(api.RequestSchema)
+	if reqSchema == nil && topic != nil && topic.RequestType != nil {
+		reqSchema = reflectSchema(topic.RequestType, 0)
+	}
+	if reqSchema != nil {
+		op.RequestBody = &OpenAPIBody{
+			Content: map[string]*OpenAPIMediaType{service.MIMEApplicationJSON: {Schema: reqSchema}},
+		}
+	}
+
+	result := declaredSchema(api.ResponseSchema)
+	if result == nil && topic != nil && topic.ResponseType != nil {
+		result = reflectSchema(topic.ResponseType, 0)
+	}
+	if result == nil {
+		result = map[string]interface{}{}
+	}
+
+	op.Responses = openAPIResponses(result, mode)
+	return op
+}
+
+// openAPIResponses the responses of the result in the response mode
+func openAPIResponses(result map[string]interface{}, mode gateway.ResponseMode) map[string]*OpenAPIResponse {
+	schema, desc := responseSchema(result), "the result of the component, code is not 0 if failed"
+	switch mode {
+	case gateway.ResponseModeRaw:
+		schema, desc = result, "the result of the component"
+	case gateway.ResponseModeProblem:
+		desc = "the result of the component"
+	}
+
+	responses := map[string]*OpenAPIResponse{
+		"200": {
+			Description: desc,
+			Content:     map[string]*OpenAPIMediaType{service.MIMEApplicationJSON: {Schema: schema}},
+		},
+	}
+	if mode != gateway.ResponseModeRaw && mode != gateway.ResponseModeProblem {
+		return responses
+	}
+
+	responses["default"] = &OpenAPIResponse{
+		Description: "the error, the status is derived from the code",
+		Content:     map[string]*OpenAPIMediaType{service.MIMEApplicationProblemJSON: {Schema: problemSchema()}},
+	}
+	return responses
+}
+
+// responseSchema the schema of server.Response with the result
+func responseSchema(result map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"request_id": map[string]interface{}{"type": "string"},
+			"client_ip":  map[string]interface{}{"type": "string"},
+			"server_ip":  map[string]interface{}{"type": "string"},
+			"trace_id":   map[string]interface{}{"type": "string", "deprecated": true},
+			"trace_ip":   map[string]interface{}{"type": "string", "deprecated": true},
+			"code":       map[string]interface{}{"type": "integer"},
+			"namespace":  map[string]interface{}{"type": "string"},
+			"msg":        map[string]interface{}{"type": "string"},
+			"details": map[string]interface{}{
+				"type": "object", "additionalProperties": map[string]interface{}{"type": "string"},
+			},
+			"retryable": map[string]interface{}{"type": "boolean"},
+			"result":    result,
+		},
+	}
+}
+
+// problemSchema the schema of server.Problem
+func problemSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type":      map[string]interface{}{"type": "string"},
+			"title":     map[string]interface{}{"type": "string"},
+			"status":    map[string]interface{}{"type": "integer"},
+			"detail":    map[string]interface{}{"type": "string"},
+			"instance":  map[string]interface{}{"type": "string"},
+			"code":      map[string]interface{}{"type": "integer"},
+			"namespace": map[string]interface{}{"type": "string"},
+			"details": map[string]interface{}{
+				"type": "object", "additionalProperties": map[string]interface{}{"type": "string"},
+			},
+			"retryable":  map[string]interface{}{"type": "boolean"},
+			"request_id": map[string]interface{}{"type": "string"},
+		},
+	}
+}
+
+// declaredSchema the schema of the reference declared by the api, see compileSchema
+func declaredSchema(ref string) map[string]interface{} {
+	ref = strings.TrimSpace(ref)
+	switch {
+	case ref == "":
+		return nil
+	case strings.HasPrefix(ref, ProtoSchemaPrefix):
+		name := protoreflect.FullName(strings.TrimPrefix(ref, ProtoSchemaPrefix))
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(name)
+		if err != nil {
+			return nil
+		}
+		return protoMessageSchema(mt.Descriptor(), 0)
+	case strings.HasPrefix(ref, "{"):
+		schema := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(ref), &schema); err != nil {
+			return nil
+		}
+		return schema
+	case strings.HasPrefix(ref, "http://"), strings.HasPrefix(ref, "https://"):
+		return map[string]interface{}{"$ref": ref}
+	default:
+		data, err := ioutil.ReadFile(ref)
+		if err != nil {
+			return map[string]interface{}{"$ref": ref}
+		}
+		schema := map[string]interface{}{}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return map[string]interface{}{"$ref": ref}
+		}
+		return schema
+	}
+}
+
+var typeOfTime = reflect.TypeOf(time.Time{})
+
+// reflectSchema the schema of the go type encoded by encoding/json
+func reflectSchema(t reflect.Type, depth int) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if depth > maxSchemaDepth {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": reflectSchema(t.Elem(), depth+1)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": reflectSchema(t.Elem(), depth+1)}
+	case reflect.Struct:
+		if t == typeOfTime {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		props := make(map[string]interface{})
+		addStructProperties(props, t, depth)
+		return map[string]interface{}{"type": "object", "properties": props}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func addStructProperties(props map[string]interface{}, t reflect.Type, depth int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructProperties(props, ft, depth)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = reflectSchema(f.Type, depth+1)
+	}
+}
+
+// protoMessageSchema the schema of the proto message encoded by protojson
+func protoMessageSchema(desc protoreflect.MessageDescriptor, depth int) map[string]interface{} {
+	if depth > maxSchemaDepth {
+		return map[string]interface{}{}
+	}
+
+	switch desc.FullName() {
+	case "google.protobuf.Timestamp":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return map[string]interface{}{"type": "string"}
+	case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.Any":
+		return map[string]interface{}{}
+	}
+
+	props := make(map[string]interface{})
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		switch {
+		case fd.IsMap():
+			props[fd.JSONName()] = map[string]interface{}{
+				"type": "object", "additionalProperties": protoFieldSchema(fd.MapValue(), depth),
+			}
+		case fd.IsList():
+			props[fd.JSONName()] = map[string]interface{}{"type": "array", "items": protoFieldSchema(fd, depth)}
+		default:
+			props[fd.JSONName()] = protoFieldSchema(fd, depth)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func protoFieldSchema(fd protoreflect.FieldDescriptor, depth int) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// 64 bits integers are encoded as strings by protojson
+		return map[string]interface{}{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number"}
+	case protoreflect.StringKind:
+		return map[string]interface{}{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		enum := make([]string, 0, values.Len())
+		for i := 0; i < values.Len(); i++ {
+			enum = append(enum, string(values.Get(i).Name()))
+		}
+		return map[string]interface{}{"type": "string", "enum": enum}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoMessageSchema(fd.Message(), depth+1)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// lookupTopic the topic of the api's local component
+func (p *httpServer) lookupTopic(api *API) *component.Topic {
+	if p.options.CompManager == nil {
+		return nil
+	}
+
+	cpt, err := p.options.CompManager.GetComponent(&service.Service{
+		Domain: api.ServiceDomain, Name: api.ServiceName, Version: api.ServiceVersion})
+	if err != nil {
+		return nil
+	}
+
+	lister, ok := cpt.(component.TopicLister)
+	if !ok {
+		return nil
+	}
+
+	for _, t := range lister.ListTopics() {
+		if t.Name == api.Topic {
+			return &t
+		}
+	}
+	return nil
+}
+
+// openAPI serve the openapi document of the loaded apis
+func (p *httpServer) openAPI(gCtx *gin.Context) {
+	gCtx.JSON(http.StatusOK, newOpenAPI(p.openAPIInfo, p.postPath, p.gateway.Mode, p.pipeline.APIs(), p.lookupTopic))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/service/component"
+)
+
+type openAPIUser struct {
+	ID      string            `json:"id"`
+	Tags    []string          `json:"tags,omitempty"`
+	Labels  map[string]string `json:"labels"`
+	Ignored string            `json:"-"`
+}
+
+func TestNewOpenAPI(t *testing.T) {
+	apis := map[string]*API{
+		"user.get": {Name: "user.get", ServiceName: "user", ServiceVersion: "v1", Topic: "get",
+			Method: "GET", Path: "/users/:id", Headers: "X-Lang", Roles: "admin"},
+		"ping": {Name: "ping", ServiceName: "ping", ServiceVersion: "v1", Topic: "ping", Anonymous: true,
+			RequestSchema: `{"type": "object"}`, ResponseSchema: ProtoSchemaPrefix + "message.Error"},
+	}
+
+	lookup := func(api *API) *component.Topic {
+		if api.Name != "user.get" {
+			return nil
+		}
+		return &component.Topic{Name: "get", ResponseType: reflect.TypeOf(&openAPIUser{})}
+	}
+
+	doc := newOpenAPI(OpenAPIInfo{Title: "test", Version: "v1"}, "/v1", "", apis, lookup)
+	testutils.Equals(t, 2, len(doc.Paths))
+
+	op := doc.Paths["/users/{id}"]["get"]
+	testutils.Assert(t, op != nil, "rest operation should be generated")
+	testutils.Equals(t, "user.get", op.OperationID)
+	testutils.Equals(t, 2, len(op.Parameters))
+	testutils.Equals(t, []string{"admin"}, op.Roles)
+
+	result := op.Responses["200"].Content["application/json"].Schema["properties"].(map[string]interface{})["result"]
+	props := result.(map[string]interface{})["properties"].(map[string]interface{})
+	testutils.Equals(t, 3, len(props))
+	testutils.Equals(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}, props["tags"])
+
+	post := doc.Paths["/v1"]["post"]
+	testutils.Assert(t, post != nil, "x-api operation should be generated")
+	testutils.Equals(t, "X-Api", post.Parameters[0].Name)
+	testutils.Equals(t, []string{"ping", "user.get"}, post.Parameters[0].Schema["enum"])
+	testutils.Equals(t, 2, len(post.APIs))
+
+	op = post.APIs["ping"]
+	testutils.Equals(t, "ping", op.OperationID)
+	testutils.Equals(t, map[string]interface{}{"type": "object"}, op.RequestBody.Content["application/json"].Schema)
+
+	result = op.Responses["200"].Content["application/json"].Schema["properties"].(map[string]interface{})["result"]
+	props = result.(map[string]interface{})["properties"].(map[string]interface{})
+	testutils.Equals(t, map[string]interface{}{"type": "string", "format": "int64"}, props["code"])
+}
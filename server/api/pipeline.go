@@ -0,0 +1,280 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/internal/ratelimit"
+	"github.com/iTrellis/trellis/server/auth"
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// Pipeline the per-api steps shared by the gateways serving the apis, such as the api server and
+// the websocket server: rate limits, authentication, authorization, schemas and traffic splits
+type Pipeline struct {
+	gateway *gateway.Gateway
+	logger  logger.Logger
+
+	limiter *ratelimit.APILimiter
+
+	// authenticators of the apis, nil if auth is disabled
+	authenticators *auth.Chain
+
+	// validateResponse validate the responses by the schemas, only if gin mode is not release
+	validateResponse bool
+
+	syncer sync.RWMutex
+	apis   map[string]*API
+	// traffic splits of the apis which declare versions or rules
+	splits map[string]*trafficSplit
+	// schemas of the apis which declare request or response schema
+	schemas map[string]*apiSchemas
+	// compiled the compiled schemas keyed by the references, such as the inline schemas or the urls,
+	// so that the unchanged schemas are not compiled or fetched again in every sync
+	compiled map[string]schemaValidator
+}
+
+// NewPipeline new pipeline by the http config of the gateway: rate_limits, auth and validate_response,
+// see examples/http_server/trellis_server/config.yaml
+func NewPipeline(gw *gateway.Gateway, l logger.Logger) (*Pipeline, error) {
+	p := &Pipeline{
+		gateway: gw,
+		logger:  l,
+		apis:    make(map[string]*API),
+	}
+
+	conf := gw.Conf
+	if err := p.initRateLimits(conf.GetValuesConfig("rate_limits")); err != nil {
+		return nil, err
+	}
+
+	if authConf := conf.GetValuesConfig("auth"); authConf != nil && authConf.GetBoolean("enabled", false) {
+		chain, err := auth.NewChain(authConf.GetValuesConfig("authenticators"))
+		if err != nil {
+			return nil, err
+		}
+		p.authenticators = chain
+	}
+
+	p.validateResponse = conf.GetBoolean("validate_response", false) && gw.GinMode != gin.ReleaseMode
+
+	return p, nil
+}
+
+// initRateLimits token buckets of the apis keyed by api name, client ip or header,
+// see rate_limits in examples/http_server/trellis_server/config.yaml
+func (p *Pipeline) initRateLimits(conf config.Config) error {
+	if conf == nil {
+		return nil
+	}
+
+	rules := make(map[string]*ratelimit.Rule)
+	for _, key := range conf.GetKeys() {
+		rule := &ratelimit.Rule{}
+		if err := conf.ToObject(key, rule); err != nil {
+			return err
+		}
+		rules[key] = rule
+	}
+
+	limiter, err := ratelimit.NewAPILimiter(rules)
+	if err != nil {
+		return err
+	}
+	p.limiter = limiter
+	return nil
+}
+
+// SetAPIs replace the apis with their traffic splits and schemas,
+// the api whose schemas are failed to compile keeps the last schemas, or it's disabled if it has none,
+// so that the apis are never served without the validation
+func (p *Pipeline) SetAPIs(apis map[string]*API) {
+	p.syncer.RLock()
+	lastSchemas, lastCompiled := p.schemas, p.compiled
+	p.syncer.RUnlock()
+
+	compiled := make(map[string]schemaValidator)
+	compile := func(ref string) (schemaValidator, error) {
+		ref = strings.TrimSpace(ref)
+		if v, ok := compiled[ref]; ok {
+			return v, nil
+		}
+		v, ok := lastCompiled[ref]
+		if !ok {
+			var err error
+			if v, err = compileSchema(ref); err != nil {
+				return nil, err
+			}
+		}
+		compiled[ref] = v
+		return v, nil
+	}
+
+	served := make(map[string]*API, len(apis))
+	splits := make(map[string]*trafficSplit)
+	schemas := make(map[string]*apiSchemas)
+	for name, api := range apis {
+		as, err := newAPISchemas(api, compile)
+		if err != nil {
+			last, ok := lastSchemas[name]
+			if !ok {
+				p.logger.Error("invalid_api_schemas", "api_name", name, "err", err.Error(), "result", "api_disabled")
+				continue
+			}
+			p.logger.Error("invalid_api_schemas", "api_name", name, "err", err.Error(), "result", "last_schemas_kept")
+			as = last
+		}
+		if as != nil {
+			schemas[name] = as
+		}
+
+		ts, err := newTrafficSplit(api)
+		if err != nil {
+			p.logger.Error("invalid_api_versions", "err", err.Error())
+		} else if ts != nil {
+			splits[name] = ts
+		}
+
+		served[name] = api
+	}
+
+	p.syncer.Lock()
+	p.apis = served
+	p.splits = splits
+	p.schemas = schemas
+	p.compiled = compiled
+	p.syncer.Unlock()
+}
+
+// GetAPI get the api by name
+func (p *Pipeline) GetAPI(name string) (*API, bool) {
+	p.syncer.RLock()
+	api, ok := p.apis[name]
+	p.syncer.RUnlock()
+	return api, ok
+}
+
+// APIs the apis keyed by name, which should not be modified
+func (p *Pipeline) APIs() map[string]*API {
+	p.syncer.RLock()
+	defer p.syncer.RUnlock()
+	return p.apis
+}
+
+// Allow check the rate limits of the api, the rejected request gets the error of too many requests
+func (p *Pipeline) Allow(api *API, clientIP string, header http.Header) error {
+	if rule, ok := p.limiter.Allow(api.Name, clientIP, header); !ok {
+		return p.gateway.NewError(message.ErrCodeTooManyRequests, "too many requests").
+			SetDetail("rate_limit", rule).SetRetryable(true)
+	}
+	return nil
+}
+
+// Authenticate the caller of the request, nil principal if auth is disabled or the request has no credentials
+func (p *Pipeline) Authenticate(req *http.Request) (*auth.Principal, error) {
+	if p.authenticators == nil {
+		return nil, nil
+	}
+
+	principal, err := p.authenticators.Authenticate(req)
+	if err != nil {
+		return nil, p.gateway.NewError(message.ErrCodeUnauthorized, fmt.Sprintf("unauthorized: %s", err.Error()))
+	}
+	return principal, nil
+}
+
+// Authorize the principal by the roles of the api, the anonymous callers are only allowed by the anonymous apis
+func (p *Pipeline) Authorize(principal *auth.Principal, api *API) error {
+	if p.authenticators == nil {
+		return nil
+	}
+
+	if principal == nil {
+		if api.Anonymous {
+			return nil
+		}
+		return p.gateway.NewError(message.ErrCodeUnauthorized, "unauthorized: credentials required")
+	}
+
+	if roles := api.RoleList(); len(roles) != 0 && !principal.HasAnyRole(roles...) {
+		return p.gateway.NewError(message.ErrCodeForbidden, "forbidden").SetDetail("principal", principal.ID)
+	}
+	return nil
+}
+
+// ValidateRequest validate the body by the request schema of the api
+func (p *Pipeline) ValidateRequest(api *API, body []byte) error {
+	p.syncer.RLock()
+	schemas := p.schemas[api.Name]
+	p.syncer.RUnlock()
+
+	if schemas == nil || schemas.request == nil {
+		return nil
+	}
+
+	errs := schemas.request.validate(body)
+	if errs == nil {
+		return nil
+	}
+
+	vErr := p.gateway.NewError(message.ErrCodeBadRequest, "invalid request body")
+	for field, msg := range errs {
+		vErr.SetDetail(field, msg)
+	}
+	return vErr
+}
+
+// ValidateResponse validate the result by the response schema of the api, only if validate_response is enabled
+func (p *Pipeline) ValidateResponse(api *API, resp interface{}) error {
+	if !p.validateResponse {
+		return nil
+	}
+
+	p.syncer.RLock()
+	schemas := p.schemas[api.Name]
+	p.syncer.RUnlock()
+
+	if schemas == nil || schemas.response == nil {
+		return nil
+	}
+	return validateResponse(schemas.response, resp)
+}
+
+// ServiceVersion pick the service version by the traffic split of the api
+func (p *Pipeline) ServiceVersion(api *API, header http.Header) string {
+	p.syncer.RLock()
+	ts := p.splits[api.Name]
+	p.syncer.RUnlock()
+	if ts == nil {
+		return api.ServiceVersion
+	}
+
+	if version, ok := ts.pick(header, randIntn); ok {
+		return version
+	}
+	return api.ServiceVersion
+}
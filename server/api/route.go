@@ -0,0 +1,161 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type segmentType int
+
+const (
+	segmentStatic segmentType = iota
+	// :name matches one segment
+	segmentParam
+	// *name matches the rest of the path
+	segmentWildcard
+)
+
+type segment struct {
+	typ   segmentType
+	value string
+}
+
+type route struct {
+	method   string
+	segments []segment
+	api      *API
+}
+
+// routes http routes of the apis declared with method and path template
+type routes []*route
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func newRoute(api *API) (*route, error) {
+	if !strings.HasPrefix(api.Path, "/") {
+		return nil, fmt.Errorf("path of api %s should start with /: %s", api.Name, api.Path)
+	}
+
+	r := &route{method: strings.ToUpper(api.Method), api: api}
+	if r.method == "" {
+		r.method = "GET"
+	}
+
+	parts := splitPath(api.Path)
+	for i, part := range parts {
+		switch {
+		case strings.HasPrefix(part, ":") && len(part) > 1:
+			r.segments = append(r.segments, segment{typ: segmentParam, value: part[1:]})
+		case strings.HasPrefix(part, "*") && len(part) > 1:
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("wildcard of api %s should be the last segment: %s", api.Name, api.Path)
+			}
+			r.segments = append(r.segments, segment{typ: segmentWildcard, value: part[1:]})
+		default:
+			r.segments = append(r.segments, segment{typ: segmentStatic, value: part})
+		}
+	}
+	return r, nil
+}
+
+// newRoutes routes of the apis which declare the path,
+// the invalid ones are returned as errors and skipped
+func newRoutes(apis map[string]*API) (routes, []error) {
+	var (
+		rs   routes
+		errs []error
+	)
+	for _, api := range apis {
+		if api.Path == "" {
+			continue
+		}
+		r, err := newRoute(api)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rs = append(rs, r)
+	}
+
+	// static segments take precedence over params, and params over wildcards
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].less(rs[j])
+	})
+	return rs, errs
+}
+
+func (p *route) less(o *route) bool {
+	for k := 0; k < len(p.segments) && k < len(o.segments); k++ {
+		if p.segments[k].typ != o.segments[k].typ {
+			return p.segments[k].typ < o.segments[k].typ
+		}
+	}
+	if len(p.segments) != len(o.segments) {
+		return len(p.segments) > len(o.segments)
+	}
+	return p.api.Name < o.api.Name
+}
+
+func (p *route) match(method string, parts []string) (map[string]string, bool) {
+	if p.method != method {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, seg := range p.segments {
+		if seg.typ == segmentWildcard {
+			params[seg.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch seg.typ {
+		case segmentStatic:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = parts[i]
+		}
+	}
+
+	if len(parts) != len(p.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// match find the api of the method and path, with the path params
+func (p routes) match(method, path string) (*API, map[string]string, bool) {
+	parts := splitPath(path)
+	for _, r := range p {
+		if params, ok := r.match(method, parts); ok {
+			return r.api, params, true
+		}
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+)
+
+func TestRoutes(t *testing.T) {
+	rs, errs := newRoutes(map[string]*API{
+		"user.get":    {Name: "user.get", Method: "get", Path: "/users/:id"},
+		"user.me":     {Name: "user.me", Method: "GET", Path: "/users/me"},
+		"user.update": {Name: "user.update", Method: "PUT", Path: "/users/:id"},
+		"user.files":  {Name: "user.files", Path: "/users/:id/files/*path"},
+		"legacy":      {Name: "legacy"},
+		"bad":         {Name: "bad", Path: "/files/*path/more"},
+	})
+	testutils.Equals(t, 1, len(errs))
+	testutils.Equals(t, 4, len(rs))
+
+	api, params, ok := rs.match("GET", "/users/1")
+	testutils.Equals(t, true, ok)
+	testutils.Equals(t, "user.get", api.Name)
+	testutils.Equals(t, map[string]string{"id": "1"}, params)
+
+	api, _, ok = rs.match("GET", "/users/me")
+	testutils.Equals(t, true, ok)
+	testutils.Equals(t, "user.me", api.Name)
+
+	api, _, ok = rs.match("PUT", "/users/me/")
+	testutils.Equals(t, true, ok)
+	testutils.Equals(t, "user.update", api.Name)
+
+	api, params, ok = rs.match("GET", "/users/1/files/a/b.txt")
+	testutils.Equals(t, true, ok)
+	testutils.Equals(t, "user.files", api.Name)
+	testutils.Equals(t, map[string]string{"id": "1", "path": "a/b.txt"}, params)
+
+	_, _, ok = rs.match("DELETE", "/users/1")
+	testutils.Equals(t, false, ok)
+
+	_, _, ok = rs.match("GET", "/users")
+	testutils.Equals(t, false, ok)
+
+	_, _, ok = rs.match("GET", "/users/1/profile")
+	testutils.Equals(t, false, ok)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	_ "github.com/santhosh-tekuri/jsonschema/v5/httploader" // load the schemas by http urls
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ProtoSchemaPrefix prefix of the schema which references a registered proto message, such as proto:pkg.Request
+const ProtoSchemaPrefix = "proto:"
+
+// schemaValidator validator of the json bodies
+type schemaValidator interface {
+	// validate returns the errors by the locations of fields, nil if the body is valid
+	validate(body []byte) map[string]string
+}
+
+// apiSchemas the validators of the api, nil if not declared
+type apiSchemas struct {
+	request  schemaValidator
+	response schemaValidator
+}
+
+// newAPISchemas compile the schemas of the api by the compile function, such as compileSchema
+func newAPISchemas(api *API, compile func(ref string) (schemaValidator, error)) (*apiSchemas, error) {
+	if api.RequestSchema == "" && api.ResponseSchema == "" {
+		return nil, nil
+	}
+
+	as := &apiSchemas{}
+	var err error
+	if as.request, err = compile(api.RequestSchema); err != nil {
+		return nil, fmt.Errorf("api %s: bad request schema: %s", api.Name, err.Error())
+	}
+	if as.response, err = compile(api.ResponseSchema); err != nil {
+		return nil, fmt.Errorf("api %s: bad response schema: %s", api.Name, err.Error())
+	}
+	return as, nil
+}
+
+// compileSchema compile the schema reference, which is one of:
+// proto:full.MessageName of the registered proto message,
+// inline json schema starts with {,
+// file path or url of the json schema
+func compileSchema(ref string) (schemaValidator, error) {
+	ref = strings.TrimSpace(ref)
+	switch {
+	case ref == "":
+		return nil, nil
+	case strings.HasPrefix(ref, ProtoSchemaPrefix):
+		name := protoreflect.FullName(strings.TrimPrefix(ref, ProtoSchemaPrefix))
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return &protoSchema{desc: mt.Descriptor()}, nil
+	case strings.HasPrefix(ref, "{"):
+		c := jsonschema.NewCompiler()
+		if err := c.AddResource("inline.json", strings.NewReader(ref)); err != nil {
+			return nil, err
+		}
+		s, err := c.Compile("inline.json")
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{schema: s}, nil
+	default:
+		s, err := jsonschema.Compile(ref)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{schema: s}, nil
+	}
+}
+
+type jsonSchema struct {
+	schema *jsonschema.Schema
+}
+
+func (p *jsonSchema) validate(body []byte) map[string]string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte("null")
+	}
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return map[string]string{"/": fmt.Sprintf("bad json: %s", err.Error())}
+	}
+
+	err := p.schema.Validate(v)
+	if err == nil {
+		return nil
+	}
+
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return map[string]string{"/": err.Error()}
+	}
+
+	errs := make(map[string]string)
+	addValidationErrors(errs, ve)
+	return errs
+}
+
+// addValidationErrors add the leaf errors by the instance locations
+func addValidationErrors(errs map[string]string, ve *jsonschema.ValidationError) {
+	if len(ve.Causes) > 0 {
+		for _, c := range ve.Causes {
+			addValidationErrors(errs, c)
+		}
+		return
+	}
+
+	loc := ve.InstanceLocation
+	if loc == "" {
+		loc = "/"
+	}
+	if msg, ok := errs[loc]; ok {
+		errs[loc] = msg + "; " + ve.Message
+		return
+	}
+	errs[loc] = ve.Message
+}
+
+type protoSchema struct {
+	desc protoreflect.MessageDescriptor
+}
+
+func (p *protoSchema) validate(body []byte) map[string]string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	msg := dynamicpb.NewMessage(p.desc)
+	if err := protojson.Unmarshal(body, msg); err != nil {
+		return map[string]string{"/": err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"testing"
+
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/server/gateway"
+)
+
+type nopLogger struct{ logger.Logger }
+
+func (nopLogger) Error(string, ...interface{}) {}
+
+func TestJSONSchema(t *testing.T) {
+	_, err := compileSchema(`{"type": "unknown"}`)
+	testutils.NotOk(t, err)
+
+	v, err := compileSchema(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0}
+		}
+	}`)
+	testutils.Ok(t, err)
+
+	testutils.Assert(t, v.validate([]byte(`{"name": "trellis", "age": 1}`)) == nil, "body should be valid")
+
+	errs := v.validate([]byte(`{"name": "", "age": -1}`))
+	testutils.Equals(t, 2, len(errs))
+	testutils.Assert(t, errs["/name"] != "", "name should be invalid")
+	testutils.Assert(t, errs["/age"] != "", "age should be invalid")
+
+	errs = v.validate(nil)
+	testutils.Assert(t, errs["/"] != "", "empty body should be invalid")
+
+	errs = v.validate([]byte(`{"name":`))
+	testutils.Assert(t, errs["/"] != "", "bad json should be invalid")
+}
+
+func TestProtoSchema(t *testing.T) {
+	_, err := compileSchema(ProtoSchemaPrefix + "message.Unknown")
+	testutils.NotOk(t, err)
+
+	v, err := compileSchema(ProtoSchemaPrefix + "message.Error")
+	testutils.Ok(t, err)
+
+	testutils.Assert(t, v.validate([]byte(`{"code": 10, "message": "bad request"}`)) == nil, "body should be valid")
+	testutils.Assert(t, v.validate([]byte(`{"unknown": 1}`)) != nil, "unknown field should be invalid")
+	testutils.Assert(t, v.validate([]byte(`{"code": "ten"}`)) != nil, "bad type should be invalid")
+}
+
+func TestPipelineSchemas(t *testing.T) {
+	schema := `{"type": "object", "required": ["name"]}`
+	p := &Pipeline{gateway: &gateway.Gateway{Namespace: apiService.TrellisPath()}, logger: nopLogger{}}
+
+	p.SetAPIs(map[string]*API{
+		"user.get": {Name: "user.get", RequestSchema: schema},
+		"user.del": {Name: "user.del", RequestSchema: `{"type": "unknown"}`},
+	})
+	_, ok := p.GetAPI("user.del")
+	testutils.Assert(t, !ok, "api with invalid schema should be disabled")
+
+	api, ok := p.GetAPI("user.get")
+	testutils.Assert(t, ok, "api with valid schema should be served")
+	testutils.NotOk(t, p.ValidateRequest(api, []byte(`{}`)))
+	compiled := p.schemas[api.Name].request
+
+	// the unchanged schema is not compiled again
+	p.SetAPIs(map[string]*API{"user.get": {Name: "user.get", RequestSchema: schema}})
+	testutils.Assert(t, p.schemas[api.Name].request == compiled, "compiled schema should be cached")
+
+	// the broken schema keeps the last one
+	p.SetAPIs(map[string]*API{"user.get": {Name: "user.get", RequestSchema: `{"type": "unknown"}`}})
+	api, ok = p.GetAPI("user.get")
+	testutils.Assert(t, ok, "api should be served by the last schema")
+	testutils.NotOk(t, p.ValidateRequest(api, []byte(`{}`)))
+	testutils.Ok(t, p.ValidateRequest(api, []byte(`{"name": "trellis"}`)))
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trafficSplit the backend service versions of an api, the header rules are matched in order,
+// then the version is picked by the weights, the service version of the api is used if nothing matched
+type trafficSplit struct {
+	rules   []splitRule
+	weights []versionWeight
+	total   int
+}
+
+type splitRule struct {
+	header  string
+	value   string
+	version string
+}
+
+type versionWeight struct {
+	version string
+	weight  int
+}
+
+var (
+	splitRandLocker sync.Mutex
+	splitRand       = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func randIntn(n int) int {
+	splitRandLocker.Lock()
+	defer splitRandLocker.Unlock()
+	return splitRand.Intn(n)
+}
+
+// newTrafficSplit parse the versions & rules of the api, nil if the api has only one version
+func newTrafficSplit(api *API) (*trafficSplit, error) {
+	versions, rules := api.VersionList(), api.RuleList()
+	if len(versions) == 0 && len(rules) == 0 {
+		return nil, nil
+	}
+
+	ts := &trafficSplit{}
+	for _, v := range versions {
+		i := strings.LastIndex(v, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("api %s: bad version weight: %s", api.Name, v)
+		}
+		weight, err := strconv.Atoi(v[i+1:])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("api %s: bad version weight: %s", api.Name, v)
+		}
+		ts.weights = append(ts.weights, versionWeight{version: v[:i], weight: weight})
+		ts.total += weight
+	}
+
+	for _, r := range rules {
+		i, j := strings.Index(r, "="), strings.LastIndex(r, ":")
+		if i <= 0 || j <= i || j == len(r)-1 {
+			return nil, fmt.Errorf("api %s: bad version rule: %s", api.Name, r)
+		}
+		ts.rules = append(ts.rules, splitRule{
+			header:  strings.TrimSpace(r[:i]),
+			value:   strings.TrimSpace(r[i+1 : j]),
+			version: strings.TrimSpace(r[j+1:]),
+		})
+	}
+	return ts, nil
+}
+
+// pick pick the service version of the request, intn returns a random number in [0, n)
+func (p *trafficSplit) pick(header http.Header, intn func(int) int) (string, bool) {
+	for _, r := range p.rules {
+		if v := header.Get(r.header); v != "" && (r.value == "*" || strings.EqualFold(v, r.value)) {
+			return r.version, true
+		}
+	}
+
+	if p.total <= 0 {
+		return "", false
+	}
+
+	n := intn(p.total)
+	for _, w := range p.weights {
+		if n < w.weight {
+			return w.version, true
+		}
+		n -= w.weight
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+)
+
+func TestTrafficSplit(t *testing.T) {
+	ts, err := newTrafficSplit(&API{Name: "legacy", ServiceVersion: "v1"})
+	testutils.Ok(t, err)
+	testutils.Assert(t, ts == nil, "api without versions should not be split")
+
+	_, err = newTrafficSplit(&API{Name: "bad", Versions: "v1"})
+	testutils.NotOk(t, err)
+
+	_, err = newTrafficSplit(&API{Name: "bad", Rules: "X-Canary:v2"})
+	testutils.NotOk(t, err)
+
+	ts, err = newTrafficSplit(&API{Name: "user.get", Versions: "v1:95, v2:5", Rules: "X-Canary=true:v3,X-Beta=*:v2"})
+	testutils.Ok(t, err)
+	testutils.Equals(t, 100, ts.total)
+
+	header := http.Header{}
+	header.Set("X-Canary", "true")
+	version, ok := ts.pick(header, func(int) int { return 0 })
+	testutils.Equals(t, true, ok)
+	testutils.Equals(t, "v3", version)
+
+	header = http.Header{}
+	header.Set("X-Beta", "yes")
+	version, _ = ts.pick(header, func(int) int { return 0 })
+	testutils.Equals(t, "v2", version)
+
+	version, _ = ts.pick(http.Header{}, func(int) int { return 94 })
+	testutils.Equals(t, "v1", version)
+
+	version, _ = ts.pick(http.Header{}, func(int) int { return 95 })
+	testutils.Equals(t, "v2", version)
+
+	ts, err = newTrafficSplit(&API{Name: "rules.only", Rules: "X-Canary=true:v2"})
+	testutils.Ok(t, err)
+	_, ok = ts.pick(http.Header{}, randIntn)
+	testutils.Equals(t, false, ok)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+// APIStatusNormal status of the apis which could be called
+const APIStatusNormal = "normal"
+
+// APIStore the storage of the apis
+type APIStore interface {
+	// Load load all the apis which could be called
+	Load() (map[string]*API, error)
+	// Watch watch the changes of the apis in background,
+	// fn is called with all the apis after they are changed
+	Watch(fn func(map[string]*API))
+	// Stop stop watching and release the resources
+	Stop() error
+	// Status status of the latest sync
+	Status() SyncStatus
+}
+
+// SyncStatus status of the latest sync of the api store
+type SyncStatus struct {
+	// LastSync time of the last successful sync, zero if the apis have never been loaded
+	LastSync  time.Time `json:"last_sync"`
+	LastError string    `json:"last_error,omitempty"`
+	// LastErrorAt time of the last failed sync
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+}
+
+// syncRecorder records the sync status for the stores
+type syncRecorder struct {
+	mu     sync.RWMutex
+	status SyncStatus
+}
+
+func (p *syncRecorder) succeed() {
+	p.mu.Lock()
+	p.status.LastSync = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *syncRecorder) fail(err error) {
+	p.mu.Lock()
+	p.status.LastError = err.Error()
+	p.status.LastErrorAt = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *syncRecorder) Status() SyncStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.status
+}
+
+// NewAPIStoreFunc new api store with the apis' config
+type NewAPIStoreFunc func(conf config.Config, opts component.Options) (APIStore, error)
+
+var (
+	storesLocker sync.RWMutex
+	storeFuncs   = map[string]NewAPIStoreFunc{
+		"file":  NewFileStore,
+		"sql":   NewSQLStore,
+		"mysql": NewSQLStore,
+		"etcd":  NewEtcdStore,
+	}
+)
+
+// RegisterAPIStore register the api store of the type, which could be used by apis.type
+func RegisterAPIStore(typ string, fn NewAPIStoreFunc) {
+	if fn == nil {
+		panic("api store function should not be nil")
+	}
+
+	storesLocker.Lock()
+	defer storesLocker.Unlock()
+	if _, ok := storeFuncs[typ]; ok {
+		panic(fmt.Errorf("api store already exists: %s", typ))
+	}
+	storeFuncs[typ] = fn
+}
+
+// NewAPIStore new api store by apis.type, default is file
+func NewAPIStore(conf config.Config, opts component.Options) (APIStore, error) {
+	typ := conf.GetString("type", "file")
+
+	storesLocker.RLock()
+	fn, ok := storeFuncs[typ]
+	storesLocker.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown apis' config type: %s", typ)
+	}
+	return fn(conf, opts)
+}
+
+// newServiceFilter the filter of the apis by service_domain, service_name & service_version
+// of the apis' config, the empty fields match all, it's applied by all the built-in stores
+func newServiceFilter(conf config.Config) *service.Service {
+	return &service.Service{
+		Domain:  conf.GetString("service_domain"),
+		Name:    conf.GetString("service_name"),
+		Version: conf.GetString("service_version"),
+	}
+}
+
+// matchFilter whether the api's service is matched by the filter, nil filter matches all
+func matchFilter(filter *service.Service, api *API) bool {
+	if filter == nil {
+		return true
+	}
+	return (filter.GetDomain() == "" || filter.GetDomain() == api.ServiceDomain) &&
+		(filter.GetName() == "" || filter.GetName() == api.ServiceName) &&
+		(filter.GetVersion() == "" || filter.GetVersion() == api.ServiceVersion)
+}
+
+// parseAPIs parse the apis from config, the key of each api is ignored
+func parseAPIs(conf config.Config) (map[string]*API, error) {
+	apis := make(map[string]*API)
+	if conf == nil {
+		return apis, nil
+	}
+
+	for _, apiKey := range conf.GetKeys() {
+		apiConf := conf.GetValuesConfig(apiKey)
+		if apiConf == nil {
+			return nil, fmt.Errorf("init api failed: %s", apiKey)
+		}
+
+		api := &API{
+			Name:           apiConf.GetString("api"),
+			Topic:          apiConf.GetString("topic"),
+			ServiceDomain:  apiConf.GetString("service_domain"),
+			ServiceName:    apiConf.GetString("service_name"),
+			ServiceVersion: apiConf.GetString("service_version"),
+			Status:         apiConf.GetString("status", APIStatusNormal),
+			Anonymous:      apiConf.GetBoolean("anonymous", false),
+			Roles:          strings.Join(apiConf.GetStringList("roles"), ","),
+			Method:         apiConf.GetString("method"),
+			Path:           apiConf.GetString("path"),
+			Headers:        strings.Join(apiConf.GetStringList("headers"), ","),
+			Versions:       strings.Join(apiConf.GetStringList("versions"), ","),
+			Rules:          strings.Join(apiConf.GetStringList("rules"), ","),
+			RequestSchema:  apiConf.GetString("request_schema"),
+			ResponseSchema: apiConf.GetString("response_schema"),
+			CacheTTL:       apiConf.GetString("cache_ttl"),
+			CacheHeaders:   strings.Join(apiConf.GetStringList("cache_headers"), ","),
+			CacheMaxSize:   apiConf.GetInt("cache_max_size", 0),
+			ResponseMode:   apiConf.GetString("response_mode"),
+			MaxBodySize:    int64(apiConf.GetInt("max_body_size", 0)),
+		}
+
+		if api.Status != APIStatusNormal {
+			continue
+		}
+
+		apis[api.Name] = api
+	}
+	return apis, nil
+}
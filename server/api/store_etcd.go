@@ -0,0 +1,247 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/config"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/iTrellis/trellis/configure"
+	"github.com/iTrellis/trellis/internal/tls"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+// DefaultEtcdAPIPrefix the default prefix of the apis' keys in etcd
+const DefaultEtcdAPIPrefix = "/trellis/apis/"
+
+// etcdStore the apis are stored as json values under the prefix of etcd,
+// the changes are pushed by the watch of the prefix
+type etcdStore struct {
+	syncRecorder
+
+	client *clientv3.Client
+	prefix string
+	filter *service.Service
+
+	logger logger.Logger
+
+	mu sync.Mutex
+	// apis by key
+	apis     map[string]*API
+	revision int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewEtcdStore new api store of etcd, the endpoints are read from etcd.endpoints,
+// or from the project's registry named by etcd.registry, so that the apis could be
+// stored in the same cluster with the registry
+func NewEtcdStore(conf config.Config, opts component.Options) (APIStore, error) {
+	etcdConf := conf.GetValuesConfig("etcd")
+	if etcdConf == nil {
+		return nil, fmt.Errorf("apis' etcd config not found")
+	}
+
+	reg := &configure.Registry{
+		Endpoints: etcdConf.GetStringList("endpoints"),
+		Secure:    etcdConf.GetBoolean("secure", false),
+		Timeout:   etcdConf.GetTimeDuration("timeout", 5*time.Second),
+	}
+
+	if name := etcdConf.GetString("registry"); name != "" {
+		if opts.ProjectConfig == nil {
+			return nil, fmt.Errorf("project config not found for registry: %s", name)
+		}
+		if err := opts.ProjectConfig.ToObject("project.registries."+name, reg); err != nil {
+			return nil, err
+		}
+		if reg.Timeout == 0 {
+			reg.Timeout = 5 * time.Second
+		}
+	}
+
+	if len(reg.Endpoints) == 0 {
+		return nil, fmt.Errorf("apis' etcd endpoints not found")
+	}
+
+	cfg := clientv3.Config{
+		Endpoints:   reg.Endpoints,
+		DialTimeout: reg.Timeout,
+	}
+	tlsConf := etcdConf.GetValuesConfig("tls")
+	if reg.Secure || tlsConf != nil {
+		tlsConfig, err := tls.LoadConfig(tlsConf)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tlsConfig
+		for i, ep := range cfg.Endpoints {
+			if !strings.HasPrefix(ep, "https://") {
+				cfg.Endpoints[i] = "https://" + ep
+			}
+		}
+	}
+
+	client, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &etcdStore{
+		client: client,
+		apis:   make(map[string]*API),
+		prefix: etcdConf.GetString("prefix", DefaultEtcdAPIPrefix),
+		filter: newServiceFilter(conf),
+		logger: opts.Logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (p *etcdStore) Load() (map[string]*API, error) {
+	apis, err := p.load()
+	if err != nil {
+		p.fail(err)
+		return nil, err
+	}
+	p.succeed()
+	return apis, nil
+}
+
+func (p *etcdStore) load() (map[string]*API, error) {
+	resp, err := p.client.Get(p.ctx, p.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.apis = make(map[string]*API, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		p.put(string(kv.Key), kv.Value)
+	}
+	p.revision = resp.Header.Revision
+
+	return p.namedAPIs(), nil
+}
+
+func (p *etcdStore) put(key string, value []byte) {
+	api := &API{}
+	if err := json.Unmarshal(value, api); err != nil {
+		p.logger.Error("bad_etcd_api", "key", key, "err", err.Error())
+		delete(p.apis, key)
+		return
+	}
+
+	if api.Name == "" {
+		api.Name = strings.TrimPrefix(key, p.prefix)
+	}
+
+	if (api.Status != "" && api.Status != APIStatusNormal) || !matchFilter(p.filter, api) {
+		delete(p.apis, key)
+		return
+	}
+	p.apis[key] = api
+}
+
+func (p *etcdStore) namedAPIs() map[string]*API {
+	apis := make(map[string]*API, len(p.apis))
+	for _, api := range p.apis {
+		apis[api.Name] = api
+	}
+	return apis
+}
+
+// Watch watch the prefix from the revision of the last load,
+// all the apis are reloaded if the watch is broken, such as the revision is compacted
+func (p *etcdStore) Watch(fn func(map[string]*API)) {
+	go func() {
+		for {
+			p.mu.Lock()
+			rev := p.revision
+			p.mu.Unlock()
+
+			p.watch(rev+1, fn)
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+
+			apis, err := p.Load()
+			if err != nil {
+				p.logger.Error("reload_etcd_apis_failed", "prefix", p.prefix, "err", err.Error())
+				continue
+			}
+			p.logger.Info("reload_etcd_apis", "prefix", p.prefix, "apis", len(apis))
+			fn(apis)
+		}
+	}()
+}
+
+func (p *etcdStore) watch(rev int64, fn func(map[string]*API)) {
+	wc := p.client.Watch(p.ctx, p.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev),
+		clientv3.WithProgressNotify())
+	for resp := range wc {
+		if err := resp.Err(); err != nil {
+			p.fail(err)
+			p.logger.Error("watch_etcd_apis_failed", "prefix", p.prefix, "err", err.Error())
+			return
+		}
+
+		p.succeed()
+		if resp.IsProgressNotify() {
+			continue
+		}
+
+		p.mu.Lock()
+		for _, ev := range resp.Events {
+			switch ev.Type {
+			case clientv3.EventTypePut:
+				p.put(string(ev.Kv.Key), ev.Kv.Value)
+			case clientv3.EventTypeDelete:
+				delete(p.apis, string(ev.Kv.Key))
+			}
+		}
+		p.revision = resp.Header.Revision
+		apis := p.namedAPIs()
+		p.mu.Unlock()
+
+		p.logger.Info("watch_etcd_apis", "prefix", p.prefix, "events", len(resp.Events), "apis", len(apis))
+		fn(apis)
+	}
+}
+
+func (p *etcdStore) Stop() error {
+	p.cancel()
+	return p.client.Close()
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iTrellis/common/formats"
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+// fileStore the apis are declared in apis.file of the component's config,
+// or in the apis of the file at apis.path, which is reloaded once it's modified
+type fileStore struct {
+	syncRecorder
+
+	conf   config.Config
+	path   string
+	filter *service.Service
+
+	interval time.Duration
+	logger   logger.Logger
+
+	modTime time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewFileStore new api store of the config file
+func NewFileStore(conf config.Config, opts component.Options) (APIStore, error) {
+	return &fileStore{
+		conf:     conf,
+		path:     conf.GetString("path"),
+		filter:   newServiceFilter(conf),
+		interval: formats.ParseStringTime(conf.GetString("reload_interval", "2s")),
+		logger:   opts.Logger,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+func (p *fileStore) Load() (map[string]*API, error) {
+	apis, err := p.load()
+	if err != nil {
+		p.fail(err)
+		return nil, err
+	}
+	p.succeed()
+	return apis, nil
+}
+
+func (p *fileStore) load() (map[string]*API, error) {
+	if p.path == "" {
+		apis, err := parseAPIs(p.conf.GetValuesConfig("file"))
+		if err != nil {
+			return nil, err
+		}
+		return p.filterAPIs(apis), nil
+	}
+
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := config.NewConfig(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	apis, err := parseAPIs(c.GetValuesConfig("apis"))
+	if err != nil {
+		return nil, err
+	}
+	p.modTime = fi.ModTime()
+	return p.filterAPIs(apis), nil
+}
+
+// filterAPIs remove the apis whose service is not matched by the filter
+func (p *fileStore) filterAPIs(apis map[string]*API) map[string]*API {
+	for name, api := range apis {
+		if !matchFilter(p.filter, api) {
+			delete(apis, name)
+		}
+	}
+	return apis
+}
+
+// Watch reload the file after it's modified, nothing to watch if the apis are inline
+func (p *fileStore) Watch(fn func(map[string]*API)) {
+	if p.path == "" {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+
+			fi, err := os.Stat(p.path)
+			if err != nil {
+				p.fail(err)
+				p.logger.Error("stat_apis_file_failed", "path", p.path, "err", err.Error())
+				continue
+			}
+			if fi.ModTime().Equal(p.modTime) {
+				p.succeed()
+				continue
+			}
+
+			apis, err := p.Load()
+			if err != nil {
+				p.logger.Error("reload_apis_file_failed", "path", p.path, "err", err.Error())
+				continue
+			}
+			p.logger.Info("reload_apis_file", "path", p.path, "apis", len(apis))
+			fn(apis)
+		}
+	}()
+}
+
+func (p *fileStore) Stop() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	return nil
+}
@@ -0,0 +1,249 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iTrellis/common/formats"
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/config"
+	"github.com/iTrellis/xorm_ext"
+	"xorm.io/xorm"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+// sqlTimeLayout the layout of datetime columns, which is comparable in mysql & sqlite
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// sqlStore the apis are stored in the table of the database,
+// only the rows updated since the last sync are queried in every tick,
+// and all the rows are reloaded in a long interval for the deleted rows,
+// so the deleted rows are only removed after the next full sync,
+// disable the rows by status instead for removing the apis in the next tick.
+// The table is created by api.sql, and the tables of old versions are upgraded by api_upgrade.sql
+type sqlStore struct {
+	syncRecorder
+
+	engine *xorm.Engine
+	filter *service.Service
+
+	interval     time.Duration
+	fullInterval time.Duration
+
+	logger logger.Logger
+
+	mu sync.Mutex
+	// apis by id
+	apis        map[string]*API
+	lastUpdated time.Time
+	lastFull    time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewSQLStore new api store of the database, type sql opens the engine by sql.driver & sql.dsn,
+// and the driver should be imported by the project, type mysql uses the xorm_ext config at apis.mysql
+func NewSQLStore(conf config.Config, opts component.Options) (APIStore, error) {
+	var engine *xorm.Engine
+	switch typ := conf.GetString("type"); typ {
+	case "mysql":
+		engines, err := xorm_ext.NewEnginesFromConfig(conf.GetValuesConfig(typ))
+		if err != nil {
+			return nil, err
+		}
+		engine = engines[xorm_ext.DefaultDatabase]
+	default:
+		var err error
+		engine, err = xorm.NewEngine(conf.GetString("sql.driver"), conf.GetString("sql.dsn"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newSQLStore(engine, conf, opts), nil
+}
+
+func newSQLStore(engine *xorm.Engine, conf config.Config, opts component.Options) *sqlStore {
+	return &sqlStore{
+		engine:       engine,
+		filter:       newServiceFilter(conf),
+		interval:     formats.ParseStringTime(conf.GetString("ticker", "5s")),
+		fullInterval: formats.ParseStringTime(conf.GetString("full_sync_interval", "10m")),
+		logger:       opts.Logger,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (p *sqlStore) params() map[string]interface{} {
+	parmas := map[string]interface{}{}
+
+	if p.filter.GetDomain() != "" {
+		parmas["`service_domain`"] = p.filter.GetDomain()
+	}
+
+	if p.filter.GetName() != "" {
+		parmas["`service_name`"] = p.filter.GetName()
+	}
+
+	if p.filter.GetVersion() != "" {
+		parmas["`service_version`"] = p.filter.GetVersion()
+	}
+	return parmas
+}
+
+func (p *sqlStore) Load() (map[string]*API, error) {
+	apis, err := p.load()
+	if err != nil {
+		p.fail(err)
+		return nil, err
+	}
+	p.succeed()
+	return apis, nil
+}
+
+func (p *sqlStore) load() (map[string]*API, error) {
+	params := p.params()
+	params["`status`"] = APIStatusNormal
+
+	var rows []*API
+	if err := p.engine.Where(params).Find(&rows); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.apis = make(map[string]*API, len(rows))
+	p.lastUpdated = time.Time{}
+	for _, api := range rows {
+		p.apis[api.ID] = api
+		if api.UpdatedAt.After(p.lastUpdated) {
+			p.lastUpdated = api.UpdatedAt
+		}
+	}
+	p.lastFull = time.Now()
+
+	return p.namedAPIs(), nil
+}
+
+// sync query the rows updated since the last sync, the updated time is compared with >=,
+// because the rows updated in the same second of the last sync may not be loaded
+func (p *sqlStore) sync() (map[string]*API, bool, error) {
+	apis, changed, err := p.syncUpdated()
+	if err != nil {
+		p.fail(err)
+		return nil, false, err
+	}
+	p.succeed()
+	return apis, changed, nil
+}
+
+func (p *sqlStore) syncUpdated() (map[string]*API, bool, error) {
+	p.mu.Lock()
+	lastUpdated := p.lastUpdated.In(p.engine.DatabaseTZ).Format(sqlTimeLayout)
+	p.mu.Unlock()
+
+	var rows []*API
+	if err := p.engine.Where(p.params()).And("`updated_at` >= ?", lastUpdated).Find(&rows); err != nil {
+		return nil, false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	changed := false
+	for _, api := range rows {
+		if api.UpdatedAt.After(p.lastUpdated) {
+			p.lastUpdated = api.UpdatedAt
+		}
+
+		old, ok := p.apis[api.ID]
+		if api.Status != APIStatusNormal {
+			if ok {
+				delete(p.apis, api.ID)
+				changed = true
+			}
+			continue
+		}
+
+		if ok && *old == *api {
+			continue
+		}
+		p.apis[api.ID] = api
+		changed = true
+	}
+
+	return p.namedAPIs(), changed, nil
+}
+
+func (p *sqlStore) namedAPIs() map[string]*API {
+	apis := make(map[string]*API, len(p.apis))
+	for _, api := range p.apis {
+		apis[api.Name] = api
+	}
+	return apis
+}
+
+func (p *sqlStore) Watch(fn func(map[string]*API)) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+
+			p.mu.Lock()
+			full := time.Since(p.lastFull) >= p.fullInterval
+			p.mu.Unlock()
+
+			if full {
+				apis, err := p.Load()
+				if err != nil {
+					p.logger.Error("sync_apis_failed", "full", true, "err", err.Error())
+					continue
+				}
+				p.logger.Info("sync_apis", "full", true, "apis", len(apis))
+				fn(apis)
+				continue
+			}
+
+			apis, changed, err := p.sync()
+			if err != nil {
+				p.logger.Error("sync_apis_failed", "full", false, "err", err.Error())
+				continue
+			}
+			if changed {
+				p.logger.Info("sync_apis", "full", false, "apis", len(apis))
+				fn(apis)
+			}
+		}
+	}()
+}
+
+func (p *sqlStore) Stop() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	return nil
+}
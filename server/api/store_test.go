@@ -0,0 +1,140 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+	"github.com/iTrellis/config"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+func TestSQLStore(t *testing.T) {
+	engine, err := xorm.NewEngine("sqlite3", ":memory:")
+	testutils.Ok(t, err)
+	defer engine.Close()
+	engine.SetMaxOpenConns(1)
+
+	testutils.Ok(t, engine.Sync2(new(API)))
+
+	_, err = engine.Insert(
+		&API{ID: "1", Name: "user.get", Topic: "get", Status: APIStatusNormal},
+		&API{ID: "2", Name: "user.del", Topic: "del", Status: "deleted"},
+	)
+	testutils.Ok(t, err)
+
+	store := &sqlStore{engine: engine, filter: &service.Service{}}
+
+	apis, err := store.Load()
+	testutils.Ok(t, err)
+	testutils.Equals(t, 1, len(apis))
+	testutils.Assert(t, apis["user.get"] != nil, "user.get should be loaded")
+
+	_, changed, err := store.sync()
+	testutils.Ok(t, err)
+	testutils.Equals(t, false, changed)
+
+	_, err = engine.Insert(&API{ID: "3", Name: "user.put", Topic: "put", Status: APIStatusNormal})
+	testutils.Ok(t, err)
+	_, err = engine.Where("`id` = ?", "1").Cols("status").Update(&API{Status: "deleted"})
+	testutils.Ok(t, err)
+
+	apis, changed, err = store.sync()
+	testutils.Ok(t, err)
+	testutils.Equals(t, true, changed)
+	testutils.Equals(t, 1, len(apis))
+	testutils.Assert(t, apis["user.put"] != nil, "user.put should be added")
+}
+
+func TestSQLStoreFilter(t *testing.T) {
+	engine, err := xorm.NewEngine("sqlite3", ":memory:")
+	testutils.Ok(t, err)
+	defer engine.Close()
+	engine.SetMaxOpenConns(1)
+
+	testutils.Ok(t, engine.Sync2(new(API)))
+
+	_, err = engine.Insert(
+		&API{ID: "1", Name: "user.get.v1", ServiceName: "user", ServiceVersion: "v1", Status: APIStatusNormal},
+		&API{ID: "2", Name: "user.get.v2", ServiceName: "user", ServiceVersion: "v2", Status: APIStatusNormal},
+		&API{ID: "3", Name: "order.get", ServiceName: "order", ServiceVersion: "v2", Status: APIStatusNormal},
+	)
+	testutils.Ok(t, err)
+
+	store := &sqlStore{engine: engine, filter: &service.Service{Name: "user", Version: "v2"}}
+	testutils.Assert(t, store.Status().LastSync.IsZero(), "store should not be synced")
+
+	apis, err := store.Load()
+	testutils.Ok(t, err)
+	testutils.Equals(t, 1, len(apis))
+	testutils.Assert(t, apis["user.get.v2"] != nil, "user.get.v2 should be loaded")
+	testutils.Assert(t, !store.Status().LastSync.IsZero(), "store should be synced")
+}
+
+func TestFileStoreFilter(t *testing.T) {
+	conf := config.Options{
+		"service_name":    "user",
+		"service_version": "v2",
+		"file": map[string]interface{}{
+			"user_v1": map[string]interface{}{"api": "user.get.v1", "service_name": "user", "service_version": "v1"},
+			"user_v2": map[string]interface{}{"api": "user.get.v2", "service_name": "user", "service_version": "v2"},
+			"order":   map[string]interface{}{"api": "order.get", "service_name": "order", "service_version": "v2"},
+		},
+	}.ToConfig()
+
+	store, err := NewFileStore(conf, component.Options{})
+	testutils.Ok(t, err)
+
+	apis, err := store.Load()
+	testutils.Ok(t, err)
+	testutils.Equals(t, 1, len(apis))
+	testutils.Assert(t, apis["user.get.v2"] != nil, "user.get.v2 should be loaded")
+}
+
+func TestParseAPIs(t *testing.T) {
+	conf := config.Options{
+		"hooks": map[string]interface{}{
+			"api":             "hooks.receive",
+			"service_name":    "hooks",
+			"service_version": "v1",
+			"topic":           "receive",
+			"response_mode":   "raw",
+			"max_body_size":   1024,
+		},
+		"disabled": map[string]interface{}{
+			"api":    "hooks.disabled",
+			"status": "disabled",
+		},
+	}.ToConfig()
+
+	apis, err := parseAPIs(conf)
+	testutils.Ok(t, err)
+	testutils.Equals(t, 1, len(apis))
+
+	api := apis["hooks.receive"]
+	testutils.Assert(t, api != nil, "hooks.receive should be loaded")
+	testutils.Equals(t, "raw", api.ResponseMode)
+	testutils.Equals(t, gateway.ResponseModeRaw, api.Mode())
+	testutils.Equals(t, int64(1024), api.MaxBodySize)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// Principal the authenticated caller
+type Principal struct {
+	// id of the caller, such as token name, hmac key id or jwt subject
+	ID string `json:"id"`
+	// name of the authenticator
+	Authenticator string   `json:"authenticator"`
+	Roles         []string `json:"roles,omitempty"`
+}
+
+// HasAnyRole whether the principal has one of the roles
+func (p *Principal) HasAnyRole(roles ...string) bool {
+	if p == nil {
+		return false
+	}
+	for _, want := range roles {
+		for _, role := range p.Roles {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetPayload forward the principal to components in the payload header
+func (p *Principal) SetPayload(payload *message.Payload) {
+	// the principal headers should never come from the callers
+	delete(payload.Header, service.HeaderXPrincipalID)
+	delete(payload.Header, service.HeaderXPrincipalAuthenticator)
+	delete(payload.Header, service.HeaderXPrincipalRoles)
+	if p == nil {
+		return
+	}
+	payload.Set(service.HeaderXPrincipalID, p.ID)
+	payload.Set(service.HeaderXPrincipalAuthenticator, p.Authenticator)
+	payload.Set(service.HeaderXPrincipalRoles, strings.Join(p.Roles, ","))
+}
+
+// Authenticator authenticate the request
+type Authenticator interface {
+	// Authenticate returns nil principal without error if the request has no credentials of the authenticator,
+	// the body is not read, so that the requests are authenticated before their bodies are read
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// NewAuthenticatorFunc new authenticator with name and it's config
+type NewAuthenticatorFunc func(name string, conf config.Config) (Authenticator, error)
+
+var (
+	authenticatorsLocker  sync.RWMutex
+	newAuthenticatorFuncs = map[string]NewAuthenticatorFunc{
+		"token": NewTokenAuthenticator,
+		"hmac":  NewHMACAuthenticator,
+		"jwt":   NewJWTAuthenticator,
+	}
+)
+
+// RegisterAuthenticator register the function of newing authenticator by type
+func RegisterAuthenticator(typ string, fn NewAuthenticatorFunc) error {
+	authenticatorsLocker.Lock()
+	defer authenticatorsLocker.Unlock()
+
+	if _, ok := newAuthenticatorFuncs[typ]; ok {
+		return fmt.Errorf("authenticator type already exists: %s", typ)
+	}
+	newAuthenticatorFuncs[typ] = fn
+	return nil
+}
+
+type namedAuthenticator struct {
+	name string
+	Authenticator
+}
+
+// Chain authenticators tried in the order of names
+type Chain struct {
+	authenticators []namedAuthenticator
+}
+
+// NewChain new authenticators by config, keys are the names of authenticators,
+// see auth in examples/http_server/trellis_server/config.yaml
+func NewChain(conf config.Config) (*Chain, error) {
+	c := &Chain{}
+	if conf == nil {
+		return c, nil
+	}
+
+	names := conf.GetKeys()
+	sort.Strings(names)
+
+	for _, name := range names {
+		aConf := conf.GetValuesConfig(name)
+		typ := aConf.GetString("type")
+
+		authenticatorsLocker.RLock()
+		fn, ok := newAuthenticatorFuncs[typ]
+		authenticatorsLocker.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("authenticator %s: unknown type: %s", name, typ)
+		}
+
+		a, err := fn(name, aConf)
+		if err != nil {
+			return nil, fmt.Errorf("authenticator %s: %s", name, err.Error())
+		}
+		c.authenticators = append(c.authenticators, namedAuthenticator{name: name, Authenticator: a})
+	}
+	return c, nil
+}
+
+// Authenticate returns the principal of the first authenticator which recognizes the credentials
+func (p *Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range p.authenticators {
+		principal, err := a.Authenticate(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", a.name, err.Error())
+		}
+		if principal != nil {
+			principal.Authenticator = a.name
+			return principal, nil
+		}
+	}
+	return nil, nil
+}
+
+// credential secret and roles of the token or key
+type credential struct {
+	Secret string   `json:"secret" yaml:"secret"`
+	Roles  []string `json:"roles" yaml:"roles"`
+}
+
+func loadCredentials(conf config.Config) (map[string]*credential, error) {
+	creds := make(map[string]*credential)
+	if conf == nil {
+		return creds, nil
+	}
+	for _, key := range conf.GetKeys() {
+		c := &credential{}
+		if err := conf.ToObject(key, c); err != nil {
+			return nil, err
+		}
+		if c.Secret == "" {
+			return nil, fmt.Errorf("secret of %s is empty", key)
+		}
+		creds[key] = c
+	}
+	return creds, nil
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	a := &tokenAuthenticator{
+		header: service.HeaderXAPIToken,
+		tokens: map[string]*credential{"client_a": {Secret: "secret_a", Roles: []string{"admin"}}},
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1", nil)
+	principal, err := a.Authenticate(req)
+	testutils.Ok(t, err)
+	testutils.Assert(t, principal == nil, "no credentials")
+
+	req.Header.Set(service.HeaderXAPIToken, "secret_b")
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+
+	req.Header.Set(service.HeaderXAPIToken, "secret_a")
+	principal, err = a.Authenticate(req)
+	testutils.Ok(t, err)
+	testutils.Equals(t, "client_a", principal.ID)
+	testutils.Equals(t, true, principal.HasAnyRole("ops", "admin"))
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	a := &hmacAuthenticator{
+		maxSkew: time.Minute,
+		keys:    map[string]*credential{"app_a": {Secret: "secret_a"}},
+	}
+
+	body := []byte(`{"name":"trellis"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1?b=2&a=1", nil)
+	req.Header.Set(HeaderXAPIKey, "app_a")
+	req.Header.Set(HeaderXAPITimestamp, ts)
+	req.Header.Set(HeaderXAPIContentSHA256, BodyDigest(body))
+	req.Header.Set(HeaderXAPISignature, Sign("secret_a", http.MethodPost, "/v1?a=1&b=2", ts, BodyDigest(body)))
+
+	principal, err := a.Authenticate(req)
+	testutils.Ok(t, err)
+	testutils.Equals(t, "app_a", principal.ID)
+
+	testutils.Ok(t, VerifyBodyDigest(req, body))
+	testutils.NotOk(t, VerifyBodyDigest(req, []byte(`{"name":"changed"}`)))
+
+	// the query is signed
+	req.URL.RawQuery = "a=1&b=3"
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+	req.URL.RawQuery = "b=2&a=1"
+
+	req.Header.Del(HeaderXAPIContentSHA256)
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+	req.Header.Set(HeaderXAPIContentSHA256, BodyDigest(body))
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req.Header.Set(HeaderXAPITimestamp, old)
+	req.Header.Set(HeaderXAPISignature, Sign("secret_a", http.MethodPost, "/v1?a=1&b=2", old, BodyDigest(body)))
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	testutils.Ok(t, err)
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+
+	dir, err := ioutil.TempDir("", "jwks")
+	testutils.Ok(t, err)
+	defer os.RemoveAll(dir)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	testutils.Ok(t, ioutil.WriteFile(jwksFile, jwks, 0600))
+
+	a := &jwtAuthenticator{jwksFile: jwksFile, issuer: "trellis", rolesClaim: "roles", leeway: time.Second}
+	testutils.Ok(t, a.refreshKeys())
+
+	sign := func(claims map[string]interface{}) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+			base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		testutils.Ok(t, err)
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1", nil)
+	req.Header.Set(service.HeaderAuthorization, "Bearer "+sign(map[string]interface{}{
+		"sub": "user_a", "iss": "trellis", "roles": []string{"admin"}, "exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	principal, err := a.Authenticate(req)
+	testutils.Ok(t, err)
+	testutils.Equals(t, "user_a", principal.ID)
+	testutils.Equals(t, []string{"admin"}, principal.Roles)
+
+	req.Header.Set(service.HeaderAuthorization, "Bearer "+sign(map[string]interface{}{
+		"sub": "user_a", "iss": "trellis", "exp": time.Now().Add(-time.Hour).Unix(),
+	}))
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+
+	req.Header.Set(service.HeaderAuthorization, "Bearer "+sign(map[string]interface{}{
+		"sub": "user_a", "iss": "other",
+	}))
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+
+	// the tokens without exp are rejected unless allow_no_exp
+	token := sign(map[string]interface{}{"sub": "user_a", "iss": "trellis"})
+	req.Header.Set(service.HeaderAuthorization, "Bearer "+token)
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+
+	a.allowNoExp = true
+	principal, err = a.Authenticate(req)
+	testutils.Ok(t, err)
+	testutils.Equals(t, "user_a", principal.ID)
+
+	req.Header.Set(service.HeaderAuthorization, fmt.Sprintf("Bearer %sx", token))
+	_, err = a.Authenticate(req)
+	testutils.NotOk(t, err)
+}
+
+func TestPrincipalSetPayload(t *testing.T) {
+	payload := &message.Payload{}
+	payload.Set(service.HeaderXPrincipalID, "spoofed")
+
+	var anonymous *Principal
+	anonymous.SetPayload(payload)
+	testutils.Equals(t, "", payload.Get(service.HeaderXPrincipalID))
+
+	(&Principal{ID: "user_a", Authenticator: "jwt", Roles: []string{"a", "b"}}).SetPayload(payload)
+	testutils.Equals(t, "user_a", payload.Get(service.HeaderXPrincipalID))
+	testutils.Equals(t, "jwt", payload.Get(service.HeaderXPrincipalAuthenticator))
+	testutils.Equals(t, "a,b", payload.Get(service.HeaderXPrincipalRoles))
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iTrellis/config"
+)
+
+// headers of the hmac signed requests
+const (
+	HeaderXAPIKey       = "X-Api-Key"
+	HeaderXAPITimestamp = "X-Api-Timestamp"
+	HeaderXAPISignature = "X-Api-Signature"
+	// hex sha256 of the body, which is signed instead of the body,
+	// so that the request is authenticated before it's body is read, see VerifyBodyDigest
+	HeaderXAPIContentSHA256 = "X-Api-Content-Sha256"
+)
+
+// hmacAuthenticator requests signed by the secret of the key,
+// the timestamp of the request should be within max skew
+type hmacAuthenticator struct {
+	maxSkew time.Duration
+	keys    map[string]*credential
+}
+
+// NewHMACAuthenticator new authenticator of hmac signed requests
+func NewHMACAuthenticator(_ string, conf config.Config) (Authenticator, error) {
+	keys, err := loadCredentials(conf.GetValuesConfig("keys"))
+	if err != nil {
+		return nil, err
+	}
+	return &hmacAuthenticator{
+		maxSkew: conf.GetTimeDuration("max_skew", 5*time.Minute),
+		keys:    keys,
+	}, nil
+}
+
+// Sign the signature of the request:
+// hex(hmac-sha256(secret, method + "\n" + uri + "\n" + timestamp + "\n" + bodyDigest)),
+// uri is the canonical uri of the request, see CanonicalURI, and bodyDigest is the hex sha256 of the body
+func Sign(secret, method, uri, timestamp, bodyDigest string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestamp + "\n" + bodyDigest))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BodyDigest hex sha256 of the body, which is sent in the header X-Api-Content-Sha256
+func BodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// CanonicalURI the path with the query sorted by keys and values, such as /v1?a=1&a=2&b=3
+func CanonicalURI(u *url.URL) string {
+	query := u.Query()
+	if len(query) == 0 {
+		return u.EscapedPath()
+	}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return u.EscapedPath() + "?" + strings.Join(params, "&")
+}
+
+// Signed whether the request is signed by hmac, whose body should be buffered to be verified
+func Signed(r *http.Request) bool {
+	return r.Header.Get(HeaderXAPIKey) != ""
+}
+
+// VerifyBodyDigest check the body with the digest header which is signed by the hmac requests,
+// it passes if the request has no digest header
+func VerifyBodyDigest(r *http.Request, body []byte) error {
+	digest := r.Header.Get(HeaderXAPIContentSHA256)
+	if digest == "" {
+		return nil
+	}
+	if !hmac.Equal([]byte(strings.ToLower(digest)), []byte(BodyDigest(body))) {
+		return errors.New("body digest mismatch")
+	}
+	return nil
+}
+
+func (p *hmacAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	keyID := r.Header.Get(HeaderXAPIKey)
+	if keyID == "" {
+		return nil, nil
+	}
+
+	c, ok := p.keys[keyID]
+	if !ok {
+		return nil, errors.New("unknown key")
+	}
+
+	timestamp := r.Header.Get(HeaderXAPITimestamp)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("bad timestamp")
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > p.maxSkew || skew < -p.maxSkew {
+		return nil, errors.New("timestamp expired")
+	}
+
+	digest := r.Header.Get(HeaderXAPIContentSHA256)
+	if digest == "" {
+		return nil, errors.New("body digest required")
+	}
+
+	expected := Sign(c.Secret, r.Method, CanonicalURI(r.URL), timestamp, digest)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(HeaderXAPISignature))) {
+		return nil, errors.New("invalid signature")
+	}
+
+	return &Principal{ID: keyID, Roles: c.Roles}, nil
+}
@@ -0,0 +1,365 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/service"
+)
+
+// jwtAuthenticator bearer json web tokens signed by the keys of jwks
+type jwtAuthenticator struct {
+	sync.RWMutex
+
+	jwksFile string
+	jwksURL  string
+
+	issuer     string
+	audience   string
+	rolesClaim string
+	leeway     time.Duration
+	// allowNoExp the tokens without exp never expire, they're rejected if false
+	allowNoExp bool
+
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// NewJWTAuthenticator new authenticator of json web tokens, the keys are loaded from jwks file or url
+func NewJWTAuthenticator(_ string, conf config.Config) (Authenticator, error) {
+	p := &jwtAuthenticator{
+		jwksFile:   conf.GetString("jwks_file"),
+		jwksURL:    conf.GetString("jwks_url"),
+		issuer:     conf.GetString("issuer"),
+		audience:   conf.GetString("audience"),
+		rolesClaim: conf.GetString("roles_claim", "roles"),
+		leeway:     conf.GetTimeDuration("leeway", time.Minute),
+		allowNoExp: conf.GetBoolean("allow_no_exp", false),
+	}
+
+	if p.jwksFile == "" && p.jwksURL == "" {
+		return nil, errors.New("jwks_file or jwks_url is required")
+	}
+
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (p *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	authorization := r.Header.Get(service.HeaderAuthorization)
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(authorization, "Bearer "), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	key, err := p.getKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if err := p.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &Principal{ID: sub, Roles: rolesOfClaim(claims[p.rolesClaim])}, nil
+}
+
+func (p *jwtAuthenticator) verifyClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok && !p.allowNoExp {
+		return errors.New("token without exp")
+	}
+	if ok && now.After(time.Unix(int64(exp), 0).Add(p.leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(p.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not valid yet")
+	}
+	if p.issuer != "" && claims["iss"] != p.issuer {
+		return errors.New("invalid issuer")
+	}
+	if p.audience != "" {
+		switch aud := claims["aud"].(type) {
+		case string:
+			if aud != p.audience {
+				return errors.New("invalid audience")
+			}
+		case []interface{}:
+			for _, a := range aud {
+				if a == p.audience {
+					return nil
+				}
+			}
+			return errors.New("invalid audience")
+		default:
+			return errors.New("invalid audience")
+		}
+	}
+	return nil
+}
+
+// rolesOfClaim roles of string array or space separated string, such as scope
+func rolesOfClaim(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		var roles []string
+		for _, r := range c {
+			if s, ok := r.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	default:
+		return nil
+	}
+}
+
+func (p *jwtAuthenticator) getKey(kid string) (crypto.PublicKey, error) {
+	p.RLock()
+	key, ok := p.keys[kid]
+	refreshable := p.jwksURL != "" && time.Since(p.lastRefresh) > time.Minute
+	p.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// the keys may be rotated
+	if refreshable {
+		if err := p.refreshKeys(); err != nil {
+			return nil, err
+		}
+		p.RLock()
+		key, ok = p.keys[kid]
+		p.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key: %s", kid)
+}
+
+func (p *jwtAuthenticator) refreshKeys() error {
+	var (
+		bs  []byte
+		err error
+	)
+	if p.jwksFile != "" {
+		bs, err = ioutil.ReadFile(p.jwksFile)
+	} else {
+		bs, err = fetchJWKS(p.jwksURL)
+	}
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(bs)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	p.keys = keys
+	p.lastRefresh = time.Now()
+	p.Unlock()
+	return nil
+}
+
+func fetchJWKS(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get jwks failed, status: %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	// rsa
+	N string `json:"n"`
+	E string `json:"e"`
+	// ec
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(bs []byte) (map[string]crypto.PublicKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(bs, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err := decodeBigInt(k.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeBigInt(k.E)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+			}
+			x, err := decodeBigInt(k.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeBigInt(k.Y)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	return keys, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg: %s", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return errors.New("alg does not match the key")
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return errors.New("alg does not match the key")
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported key")
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	bs, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bs), nil
+}
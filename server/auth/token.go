@@ -0,0 +1,60 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/service"
+)
+
+// tokenAuthenticator static api tokens in the header, default X-Api-Token
+type tokenAuthenticator struct {
+	header string
+	tokens map[string]*credential
+}
+
+// NewTokenAuthenticator new authenticator of static api tokens
+func NewTokenAuthenticator(_ string, conf config.Config) (Authenticator, error) {
+	tokens, err := loadCredentials(conf.GetValuesConfig("tokens"))
+	if err != nil {
+		return nil, err
+	}
+	return &tokenAuthenticator{
+		header: conf.GetString("header", service.HeaderXAPIToken),
+		tokens: tokens,
+	}, nil
+}
+
+func (p *tokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := r.Header.Get(p.header)
+	if token == "" {
+		return nil, nil
+	}
+
+	for id, c := range p.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.Secret)) == 1 {
+			return &Principal{ID: id, Roles: c.Roles}, nil
+		}
+	}
+	return nil, errors.New("invalid token")
+}
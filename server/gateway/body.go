@@ -0,0 +1,92 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// IsStreamBody whether the body of the content type is streamed to the components rather than buffered,
+// such as the uploads of multipart/form-data and application/octet-stream
+func IsStreamBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == service.MIMEMultipartForm || mediaType == service.MIMEOctetStream
+}
+
+// LimitBody limit the request body to the size, the default max body size of the gateway if size is 0,
+// no limit if it's negative, the reads over the size return error of code ErrCodeRequestTooLarge
+func (p *Gateway) LimitBody(ctx *gin.Context, size int64) error {
+	if size == 0 {
+		size = p.MaxBodySize
+	}
+	if size <= 0 {
+		return nil
+	}
+
+	if ctx.Request.ContentLength > size {
+		return p.bodyTooLarge(size)
+	}
+
+	ctx.Request.Body = &limitedBody{ReadCloser: ctx.Request.Body, size: size, remaining: size, err: p.bodyTooLarge(size)}
+	return nil
+}
+
+func (p *Gateway) bodyTooLarge(size int64) *message.Error {
+	return p.NewError(message.ErrCodeRequestTooLarge, fmt.Sprintf("request body is larger than %d bytes", size))
+}
+
+type limitedBody struct {
+	io.ReadCloser
+
+	size      int64
+	remaining int64
+	err       error
+}
+
+// SizeLimit see message.SizeLimiter, the limited body could be buffered for the remote components
+func (p *limitedBody) SizeLimit() int64 {
+	return p.size
+}
+
+func (p *limitedBody) Read(b []byte) (int, error) {
+	if p.remaining < 0 {
+		return 0, p.err
+	}
+
+	// read one more byte to find out whether the body is over the limit
+	if int64(len(b)) > p.remaining+1 {
+		b = b[:p.remaining+1]
+	}
+
+	n, err := p.ReadCloser.Read(b)
+	p.remaining -= int64(n)
+	if p.remaining < 0 {
+		return n + int(p.remaining), p.err
+	}
+	return n, err
+}
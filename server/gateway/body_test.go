@@ -0,0 +1,115 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package gateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func TestLimitBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := &Gateway{MaxBodySize: 4}
+
+	newCtx := func(body string, contentLength int64) *gin.Context {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		ctx.Request.ContentLength = contentLength
+		return ctx
+	}
+
+	err := p.LimitBody(newCtx("12345", 5), 0)
+	testutils.NotOk(t, err)
+	testutils.Equals(t, message.ErrCodeRequestTooLarge, err.(*message.Error).GetCode())
+
+	ctx := newCtx("1234", -1)
+	testutils.Ok(t, p.LimitBody(ctx, 0))
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	testutils.Ok(t, err)
+	testutils.Equals(t, "1234", string(body))
+
+	// the length of the chunked body is unknown
+	ctx = newCtx("12345", -1)
+	testutils.Ok(t, p.LimitBody(ctx, 0))
+	_, err = ioutil.ReadAll(ctx.Request.Body)
+	testutils.NotOk(t, err)
+	testutils.Equals(t, message.ErrCodeRequestTooLarge, err.(*message.Error).GetCode())
+
+	ctx = newCtx("12345", -1)
+	testutils.Ok(t, p.LimitBody(ctx, -1))
+	body, err = ioutil.ReadAll(ctx.Request.Body)
+	testutils.Ok(t, err)
+	testutils.Equals(t, "12345", string(body))
+
+	// only the limited streamed bodies could be buffered for the remote components
+	s := &service.Service{Name: "remote", Version: "v1"}
+	ctx = newCtx("1234", -1)
+	testutils.Ok(t, p.LimitBody(ctx, 0))
+	msg := message.NewMessage(message.Service(s), message.BodyReader(ctx.Request.Body))
+	testutils.Ok(t, message.BufferBody(msg))
+	testutils.Equals(t, "1234", string(msg.GetPayload().GetBody()))
+
+	msg = message.NewMessage(message.Service(s), message.BodyReader(strings.NewReader("1234")))
+	err = message.BufferBody(msg)
+	testutils.NotOk(t, err)
+	testutils.Equals(t, message.ErrCodeRequestTooLarge, err.(*message.Error).GetCode())
+
+	testutils.Equals(t, true, IsStreamBody("multipart/form-data; boundary=xxx"))
+	testutils.Equals(t, false, IsStreamBody("application/json"))
+}
+
+func TestReplyStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := &Gateway{Mode: ResponseModeEnvelope}
+
+	chunks := make(chan interface{}, 3)
+	chunks <- server.Event{ID: "1", Event: "tick", Data: "a\nb"}
+	chunks <- map[string]int{"n": 2}
+	close(chunks)
+
+	canceled := false
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/events", nil)
+	p.Reply(ctx, p.NewResponse(ctx), &server.StreamResult{Chunks: chunks, Cancel: func() { canceled = true }})
+
+	testutils.Equals(t, "text/event-stream", w.Header().Get("Content-Type"))
+	testutils.Equals(t, "id: 1\nevent: tick\ndata: a\ndata: b\n\ndata: {\"n\":2}\n\n", w.Body.String())
+	testutils.Equals(t, true, canceled)
+
+	chunks = make(chan interface{}, 2)
+	chunks <- []byte("raw")
+	chunks <- map[string]int{"n": 2}
+	close(chunks)
+
+	w = httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/lines", nil)
+	p.Reply(ctx, p.NewResponse(ctx), &server.StreamResult{ContentType: "application/x-ndjson", Chunks: chunks})
+	testutils.Equals(t, "raw{\"n\":2}\n", w.Body.String())
+}
@@ -0,0 +1,245 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/common/errors"
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/internal/addr"
+	"github.com/iTrellis/trellis/internal/gin_middlewares"
+	"github.com/iTrellis/trellis/service/component"
+)
+
+// Handler custom http handler mounted on the gateway
+type Handler struct {
+	Name   string
+	Method string
+	Path   string
+	Func   gin.HandlerFunc
+}
+
+// HandlerProvider the component which provides custom handlers,
+// the providers are configured in http.handlers of each gateway instance
+type HandlerProvider interface {
+	HTTPHandlers() []Handler
+}
+
+// Gateway the http server shared by the gateway components, such as server/api & server/http,
+// it loads the common middlewares, mounts the custom handlers, and writes the responses in one envelope
+type Gateway struct {
+	// Engine the components register their routes before Start
+	Engine *gin.Engine
+
+	// Conf config of http
+	Conf config.Config
+
+	// Namespace namespace of the errors generated by the gateway
+	Namespace string
+
+	GinMode  string
+	ServerIP string
+
+	// Mode the default response mode of the gateway, http.response_mode
+	Mode ResponseMode
+	// MaxBodySize the default max size of the request bodies, http.max_body_size, no limit if it's 0
+	MaxBodySize int64
+
+	options component.Options
+
+	handlers []Handler
+
+	srv *http.Server
+}
+
+// New new gateway with the options of the component, errors are generated in the namespace
+func New(namespace string, opts component.Options) (*Gateway, error) {
+	p := &Gateway{Namespace: namespace, options: opts}
+
+	ips := addr.ExternalIPs()
+	if len(ips) > 0 {
+		p.ServerIP = ips[0]
+	} else {
+		p.ServerIP = "unknown server ip"
+	}
+
+	p.GinMode = opts.Config.GetString("gin_mode")
+	gin.SetMode(p.GinMode)
+
+	p.Conf = opts.Config.GetValuesConfig("http")
+	if p.Conf == nil {
+		return nil, fmt.Errorf("http config not found")
+	}
+
+	mode, err := ParseResponseMode(p.Conf.GetString("response_mode"))
+	if err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		mode = ResponseModeEnvelope
+	}
+	p.Mode = mode
+
+	p.MaxBodySize = int64(p.Conf.GetInt("max_body_size"))
+
+	engine := gin.New()
+
+	engine.Use(gin.Recovery(), gin_middlewares.NewRequestID(), gin_middlewares.StatFunc(opts.Logger))
+
+	staticPath := p.Conf.GetString("static_path")
+	staticRedirect := p.Conf.GetString("static_redirect")
+	staticRoot := p.Conf.GetString("static_root", "./root")
+	if staticPath != "" {
+		if staticRedirect != "" {
+			engine.GET(staticPath, func(c *gin.Context) {
+				c.Redirect(http.StatusFound, staticRedirect)
+			})
+
+			engine.Static(staticRedirect, staticRoot)
+		} else {
+			engine.Static(staticPath, staticRoot)
+		}
+	}
+
+	gin_middlewares.LoadPprof(engine, p.Conf.GetValuesConfig("pprof"))
+	gin_middlewares.LoadMetrics(engine, p.Conf.GetValuesConfig("metrics"))
+
+	ginHanlders := []gin.HandlerFunc{}
+
+	if gzipH := gin_middlewares.LoadGZip(p.Conf.GetValuesConfig("gzip")); gzipH != nil {
+		ginHanlders = append(ginHanlders, gzipH)
+	}
+
+	if corsH := gin_middlewares.LoadCors(p.Conf.GetValuesConfig("cors")); corsH != nil {
+		ginHanlders = append(ginHanlders, corsH)
+	}
+
+	for _, name := range gin_middlewares.IndexGinFuncs {
+		ginHanlders = append(ginHanlders, gin_middlewares.UseFuncs[name])
+	}
+	engine.Use(ginHanlders...)
+
+	p.Engine = engine
+
+	p.srv = &http.Server{
+		Addr:    p.Conf.GetString("address", ":8080"),
+		Handler: engine,
+	}
+
+	return p, nil
+}
+
+// Handle add the custom handler of the instance, which is mounted on Start
+func (p *Gateway) Handle(h Handler) error {
+	if h.Func == nil {
+		return fmt.Errorf("handler function should not be nil: %s", h.Name)
+	}
+	for _, v := range p.handlers {
+		if v.Name == h.Name {
+			return fmt.Errorf("handler already exists: %s", h.Name)
+		}
+	}
+	h.Method = strings.ToUpper(h.Method)
+	p.handlers = append(p.handlers, h)
+	return nil
+}
+
+// loadProviders add the handlers of the component instances configured in http.handlers,
+// the default instance name of a component is the trellis path of the service, such as custom/handler/v1
+func (p *Gateway) loadProviders() error {
+	providers := p.Conf.GetStringList("handlers")
+
+	if len(providers) != 0 && p.options.CompManager == nil {
+		return fmt.Errorf("gateway needs components manager for handlers")
+	}
+
+	for _, name := range providers {
+		cpt, err := p.options.CompManager.GetInstance(name)
+		if err != nil {
+			return err
+		}
+		hp, ok := cpt.(HandlerProvider)
+		if !ok {
+			return fmt.Errorf("component is not handler provider: %s", name)
+		}
+		for _, h := range hp.HTTPHandlers() {
+			if err := p.Handle(h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Start mount the custom handlers and listen
+func (p *Gateway) Start() error {
+	if err := p.loadProviders(); err != nil {
+		return err
+	}
+
+	for _, h := range p.handlers {
+		p.options.Logger.Info("start_customer_handler", "name", h.Name, "path", h.Path, "method", h.Method)
+		p.Engine.Handle(h.Method, h.Path, h.Func)
+	}
+
+	go func() {
+
+		var err error
+
+		sslConf := p.Conf.GetValuesConfig("ssl")
+
+		if sslConf != nil && sslConf.GetBoolean("enabled", false) {
+			err = p.srv.ListenAndServeTLS(
+				sslConf.GetString("cert-file"),
+				sslConf.GetString("cert-key"),
+			)
+		} else {
+			err = p.srv.ListenAndServe()
+		}
+
+		if err != nil {
+			if err != http.ErrServerClosed {
+				p.options.Logger.Error("failed_listen_and_serve", "err", err.Error())
+				log.Fatalln(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop shutdown the server in http.shutdown-timeout
+func (p *Gateway) Stop() error {
+
+	dur := p.Conf.GetTimeDuration("shutdown-timeout", time.Second*30)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dur)
+	defer cancel()
+
+	if err := p.srv.Shutdown(ctx); err != nil {
+		return errors.Newf("gateway shutdown failure, err: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iTrellis/common/testutils"
+
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+func TestHandle(t *testing.T) {
+	p := &Gateway{}
+
+	testutils.NotOk(t, p.Handle(Handler{Name: "nil"}))
+
+	fn := func(*gin.Context) {}
+	testutils.Ok(t, p.Handle(Handler{Name: "ch", Method: "post", Path: "/ch", Func: fn}))
+	testutils.NotOk(t, p.Handle(Handler{Name: "ch", Method: "get", Path: "/ch", Func: fn}))
+	testutils.Equals(t, "POST", p.handlers[0].Method)
+}
+
+func TestReply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := &Gateway{Namespace: "trellis/gateway/v1"}
+
+	reply := func(fn func(*gin.Context, *server.Response)) (*httptest.ResponseRecorder, *server.Response) {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+		ctx.Request.Header.Set(service.HeaderXRequestID, "req_1")
+		fn(ctx, p.NewResponse(ctx))
+		ctx.Writer.WriteHeaderNow()
+
+		r := &server.Response{}
+		json.Unmarshal(w.Body.Bytes(), r)
+		return w, r
+	}
+
+	w, r := reply(func(ctx *gin.Context, r *server.Response) { p.Reply(ctx, r, "pong") })
+	testutils.Equals(t, http.StatusOK, w.Code)
+	testutils.Equals(t, "pong", r.Result)
+	// the deprecated keys are emitted along with the new ones
+	testutils.Equals(t, "req_1", r.RequestID)
+	testutils.Equals(t, "req_1", r.TraceID)
+
+	w, r = reply(func(ctx *gin.Context, r *server.Response) {
+		p.Reply(ctx, r, &server.InnerResult{HTTPCode: http.StatusCreated, Body: "created"})
+	})
+	testutils.Equals(t, http.StatusCreated, w.Code)
+	testutils.Equals(t, "created", r.Result)
+
+	w, _ = reply(func(ctx *gin.Context, r *server.Response) {
+		p.Reply(ctx, r, server.InnerResult{HTTPCode: http.StatusFound, RedirectURL: "/to"})
+	})
+	testutils.Equals(t, http.StatusFound, w.Code)
+	testutils.Equals(t, "/to", w.Header().Get("Location"))
+
+	w, r = reply(func(ctx *gin.Context, r *server.Response) {
+		p.Error(ctx, r, p.NewError(message.ErrCodeAPINotFound, "api not found"))
+	})
+	// the envelope keeps the status 400 of the unknown apis for the existing clients
+	testutils.Equals(t, http.StatusBadRequest, w.Code)
+	testutils.Equals(t, message.ErrCodeAPINotFound, r.Code)
+	testutils.Equals(t, p.Namespace, r.Namespace)
+}
+
+func TestResponseModes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := &Gateway{Namespace: "trellis/gateway/v1", Mode: ResponseModeEnvelope}
+
+	_, err := ParseResponseMode("unknown")
+	testutils.NotOk(t, err)
+
+	reply := func(fn func(*gin.Context, *server.Response)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/hooks", nil)
+		fn(ctx, p.NewResponse(ctx))
+		ctx.Writer.WriteHeaderNow()
+		return w
+	}
+
+	raw := &server.RawResult{HTTPCode: http.StatusAccepted, ContentType: "text/plain", Body: []byte("accepted")}
+	w := reply(func(ctx *gin.Context, r *server.Response) { p.ReplyAs(ctx, ResponseModeRaw, r, raw) })
+	testutils.Equals(t, http.StatusAccepted, w.Code)
+	testutils.Equals(t, "text/plain", w.Header().Get("Content-Type"))
+	testutils.Equals(t, "accepted", w.Body.String())
+
+	w = reply(func(ctx *gin.Context, r *server.Response) { p.ReplyAs(ctx, ResponseModeRaw, r, map[string]int{"a": 1}) })
+	testutils.Equals(t, `{"a":1}`, w.Body.String())
+
+	w = reply(func(ctx *gin.Context, r *server.Response) { p.Reply(ctx, r, raw) })
+	r := &server.Response{}
+	testutils.Ok(t, json.Unmarshal(w.Body.Bytes(), r))
+	testutils.Equals(t, "accepted", r.Result)
+
+	w = reply(func(ctx *gin.Context, r *server.Response) {
+		p.ErrorAs(ctx, ResponseModeProblem, r, p.NewError(message.ErrCodeUnknownTopic, "unknown topic"))
+	})
+	testutils.Equals(t, http.StatusNotFound, w.Code)
+	testutils.Equals(t, "application/problem+json", w.Header().Get("Content-Type"))
+	problem := &server.Problem{}
+	testutils.Ok(t, json.Unmarshal(w.Body.Bytes(), problem))
+	testutils.Equals(t, "/hooks", problem.Instance)
+	testutils.Equals(t, "unknown topic", problem.Detail)
+
+	// the envelope replies the component errors with status 200
+	w = reply(func(ctx *gin.Context, r *server.Response) {
+		p.Error(ctx, r, p.NewError(message.ErrCodeUnknownTopic, "unknown topic"))
+	})
+	testutils.Equals(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,311 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/iTrellis/trellis/internal/addr"
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// ResponseMode how the results and errors are written
+type ResponseMode string
+
+// response modes
+const (
+	// ResponseModeEnvelope results and errors are carried in server.Response,
+	// errors are replied with the status of server.ErrorStatus
+	ResponseModeEnvelope ResponseMode = "envelope"
+	// ResponseModeRaw results are replied as they are, server.RawResult with its content type,
+	// the others in json, and errors in problem+json
+	ResponseModeRaw ResponseMode = "raw"
+	// ResponseModeProblem results are carried in server.Response,
+	// errors are replied in problem+json with the status of server.ProblemStatus
+	ResponseModeProblem ResponseMode = "problem"
+)
+
+// ParseResponseMode parse the response mode, empty is the default mode of the gateway
+func ParseResponseMode(s string) (ResponseMode, error) {
+	switch mode := ResponseMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "", ResponseModeEnvelope, ResponseModeRaw, ResponseModeProblem:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown response mode: %s", s)
+	}
+}
+
+// NewResponse new response envelope of the request
+func (p *Gateway) NewResponse(ctx *gin.Context) *server.Response {
+	reqID := ctx.GetHeader(service.HeaderXRequestID)
+	return &server.Response{
+		RequestID: reqID,
+		ClientIP:  addr.GetClientIP(ctx.Request),
+		ServerIP:  p.ServerIP,
+		TraceID:   reqID,
+		TraceIP:   p.ServerIP,
+	}
+}
+
+// NewError new error in the namespace of the gateway
+func (p *Gateway) NewError(code uint64, msg string) *message.Error {
+	return message.NewError(code, p.Namespace, msg)
+}
+
+// Error write the error in the default response mode
+func (p *Gateway) Error(ctx *gin.Context, r *server.Response, err error) {
+	p.ErrorAs(ctx, "", r, err)
+}
+
+// ErrorAs write the error into the response, and reply it in the response mode
+func (p *Gateway) ErrorAs(ctx *gin.Context, mode ResponseMode, r *server.Response, err error) {
+	r.SetError(message.FromError(err, p.Namespace))
+
+	switch p.mode(mode) {
+	case ResponseModeRaw, ResponseModeProblem:
+		problem := server.NewProblem(r, ctx.Request.URL.Path)
+		ctx.Header("Content-Type", service.MIMEApplicationProblemJSON)
+		ctx.JSON(problem.Status, problem)
+	default:
+		ctx.JSON(server.ErrorStatus(r.Code), r)
+	}
+}
+
+// Reply write the result in the default response mode
+func (p *Gateway) Reply(ctx *gin.Context, r *server.Response, resp interface{}) {
+	p.ReplyAs(ctx, "", r, resp)
+}
+
+// ReplyAs write the result of the component in the response mode
+func (p *Gateway) ReplyAs(ctx *gin.Context, mode ResponseMode, r *server.Response, resp interface{}) {
+	mode = p.mode(mode)
+
+	switch t := resp.(type) {
+	case server.InnerResult:
+		p.replyInner(ctx, mode, r, &t)
+	case *server.InnerResult:
+		p.replyInner(ctx, mode, r, t)
+	case server.RawResult:
+		p.replyRaw(ctx, mode, r, &t)
+	case *server.RawResult:
+		p.replyRaw(ctx, mode, r, t)
+	case *server.StreamResult:
+		p.replyStream(ctx, t)
+	case server.Response:
+		p.replyResponse(ctx, mode, &t)
+	case *server.Response:
+		p.replyResponse(ctx, mode, t)
+	default:
+		if mode == ResponseModeRaw {
+			if resp == nil {
+				ctx.Status(http.StatusNoContent)
+				return
+			}
+			ctx.JSON(http.StatusOK, resp)
+			return
+		}
+		r.Result = resp
+		ctx.JSON(http.StatusOK, r)
+	}
+}
+
+func (p *Gateway) mode(mode ResponseMode) ResponseMode {
+	if mode == "" {
+		return p.Mode
+	}
+	return mode
+}
+
+func (p *Gateway) replyInner(ctx *gin.Context, mode ResponseMode, r *server.Response, t *server.InnerResult) {
+	switch {
+	case t.HTTPCode == http.StatusMovedPermanently, t.HTTPCode == http.StatusFound:
+		ctx.Redirect(t.HTTPCode, t.RedirectURL)
+	case mode == ResponseModeRaw:
+		ctx.JSON(t.HTTPCode, t.Body)
+	default:
+		r.Result = t.Body
+		ctx.JSON(t.HTTPCode, r)
+	}
+}
+
+func (p *Gateway) replyRaw(ctx *gin.Context, mode ResponseMode, r *server.Response, t *server.RawResult) {
+	status := t.HTTPCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	contentType := t.ContentType
+	if contentType == "" {
+		contentType = service.MIMEOctetStream
+	}
+
+	if mode != ResponseModeRaw {
+		// the json body is carried as it is, and the others as string
+		if strings.HasPrefix(contentType, service.MIMEApplicationJSON) && json.Valid(t.Body) {
+			r.Result = json.RawMessage(t.Body)
+		} else {
+			r.Result = string(t.Body)
+		}
+		ctx.JSON(status, r)
+		return
+	}
+
+	for k, v := range t.Header {
+		ctx.Header(k, v)
+	}
+	ctx.Data(status, contentType, t.Body)
+}
+
+// replyResponse the response returned by the component, such as the remote http server
+func (p *Gateway) replyResponse(ctx *gin.Context, mode ResponseMode, t *server.Response) {
+	if mode == ResponseModeEnvelope {
+		ctx.JSON(http.StatusOK, t)
+		return
+	}
+
+	if err := t.GetError(); err != nil {
+		p.ErrorAs(ctx, mode, t, err)
+		return
+	}
+
+	if mode == ResponseModeRaw {
+		ctx.JSON(http.StatusOK, t.Result)
+		return
+	}
+	ctx.JSON(http.StatusOK, t)
+}
+
+// replyStream write the chunks until the stream is closed or the client is gone
+func (p *Gateway) replyStream(ctx *gin.Context, t *server.StreamResult) {
+	if t.Cancel != nil {
+		defer t.Cancel()
+	}
+
+	status := t.HTTPCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	contentType := t.ContentType
+	if contentType == "" {
+		contentType = service.MIMETextEventStream
+	}
+	isSSE := strings.HasPrefix(contentType, service.MIMETextEventStream)
+
+	for k, v := range t.Header {
+		ctx.Header(k, v)
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Cache-Control", "no-cache")
+	if isSSE {
+		// nginx should not buffer the events
+		ctx.Header("X-Accel-Buffering", "no")
+	}
+	ctx.Status(status)
+	ctx.Writer.Flush()
+
+	done := ctx.Request.Context().Done()
+	for {
+		select {
+		case <-done:
+			return
+		case chunk, ok := <-t.Chunks:
+			if !ok {
+				return
+			}
+			if err := writeChunk(ctx.Writer, isSSE, chunk); err != nil {
+				p.options.Logger.Error("write_stream_chunk", "request_id", ctx.GetHeader(service.HeaderXRequestID),
+					"err", err.Error())
+				return
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+func writeChunk(w io.Writer, isSSE bool, chunk interface{}) error {
+	if !isSSE {
+		switch t := chunk.(type) {
+		case []byte:
+			_, err := w.Write(t)
+			return err
+		case string:
+			_, err := io.WriteString(w, t)
+			return err
+		}
+
+		// values are written in json lines
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+
+	event, ok := chunk.(server.Event)
+	if !ok {
+		if e, isEvent := chunk.(*server.Event); isEvent {
+			event = *e
+		} else {
+			event = server.Event{Data: chunk}
+		}
+	}
+
+	data, err := chunkData(event.Data)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if event.ID != "" {
+		fmt.Fprintf(buf, "id: %s\n", event.ID)
+	}
+	if event.Event != "" {
+		fmt.Fprintf(buf, "event: %s\n", event.Event)
+	}
+	if event.Retry != 0 {
+		fmt.Fprintf(buf, "retry: %d\n", event.Retry)
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fmt.Fprintf(buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func chunkData(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case []byte:
+		return t, nil
+	case string:
+		return []byte(t), nil
+	default:
+		return json.Marshal(v)
+	}
+}
@@ -22,16 +22,24 @@ import (
 	"net"
 
 	"github.com/iTrellis/trellis/cmd"
+	"github.com/iTrellis/trellis/internal/tracing"
 	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/codec/json"
 	"github.com/iTrellis/trellis/service/component"
 	"github.com/iTrellis/trellis/service/message"
 
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 )
 
+var grpcService = &service.Service{Name: "trellis-server-grpc", Version: "v1"}
+
 func init() {
-	cmd.DefaultCompManager.RegisterComponentFunc(&service.Service{Name: "trellis-server-grpc", Version: "v1"}, NewService)
+	cmd.DefaultCompManager.RegisterComponentFunc(grpcService, NewService)
 }
 
 // Service api service
@@ -101,28 +109,52 @@ func (p *Service) Route(_ message.Message) (interface{}, error) {
 
 // Call 路由
 func (p *Service) Call(ctx context.Context, req *message.Request) (*message.Response, error) {
-	// callResp, err := p.opts.Router.Call(ctx, req)
-	// if err != nil {
-	// 	return nil, err
-	// }
-
-	// msg := &message.Response{
-	// 	Header: make(map[string]string),
-	// }
-	// t := reflect.TypeOf(callResp)
-	// switch t.Kind() {
-	// case reflect.String:
-	// 	msg.Body = []byte(callResp.(string))
-	// 	msg.Header["Content-Type"] = "text/plain"
-	// case reflect.Ptr:
-	// 	msg.Body, _ = json.Marshal(callResp)
-	// 	msg.Header["Content-Type"] = "application/json"
-	// default:
-	// 	return nil, errors.Newf("unsupported type: %s", t.String())
-	// }
-
-	// return msg, nil
-	return nil, nil
+
+	if req.Payload == nil {
+		req.Payload = &message.Payload{}
+	}
+	if !service.ValidRequestID(req.Payload.Get(service.HeaderXRequestID)) {
+		req.Payload.Set(service.HeaderXRequestID, requestIDFromContext(ctx))
+	}
+
+	_, span := tracing.StartFromPayload(req.GetPayload(), "trellis.grpc "+req.GetService().TrellisPath(),
+		trace.SpanKindServer, tracing.ServiceAttributes(req.GetService())...)
+	defer span.End()
+
+	msg := message.NewMessage(
+		message.Service(req.GetService()),
+		message.MessagePayload(req.GetPayload()),
+	)
+
+	resp := &message.Response{
+		Header: map[string]string{service.HeaderContentType: service.MIMEApplicationJSON},
+	}
+
+	callResp, err := p.opts.Caller.CallComponent(msg)
+	if err != nil {
+		// errors are carried in the response, so the caller could get the code and namespace
+		resp.Error = message.FromError(err, grpcService.TrellisPath())
+		span.SetStatus(codes.Error, resp.Error.GetMessage())
+		return resp, nil
+	}
+
+	resp.Body, err = json.NewCodec().Marshal(callResp)
+	if err != nil {
+		resp.Error = message.FromError(err, grpcService.TrellisPath())
+	}
+
+	return resp, nil
+}
+
+// requestIDFromContext get the request id from the incoming metadata, or new one
+func requestIDFromContext(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, reqID := range md.Get(service.HeaderXRequestID) {
+		if service.ValidRequestID(reqID) {
+			return reqID
+		}
+	}
+	return uuid.NewString()
 }
 
 // Publish 路由
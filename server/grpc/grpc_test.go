@@ -0,0 +1,94 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+	"google.golang.org/grpc"
+
+	"github.com/iTrellis/trellis/service"
+	cgrpc "github.com/iTrellis/trellis/service/client/grpc"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// errorCaller returns the error of the topic
+type errorCaller map[string]error
+
+func (p errorCaller) CallComponent(msg message.Message) (interface{}, error) {
+	if err := p[msg.Topic()]; err != nil {
+		return nil, err
+	}
+	return map[string]string{"topic": msg.Topic()}, nil
+}
+
+func TestCallErrors(t *testing.T) {
+	caller := errorCaller{
+		"plain":      errors.New("boom"),
+		"structured": message.NewError(message.ErrCodeForbidden, "trellis/a/v1", "forbidden").SetDetail("principal", "u1").SetRetryable(true),
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	testutils.Ok(t, err)
+	s := grpc.NewServer()
+	RegisterClientServer(s, &Service{opts: component.Options{Caller: caller}})
+	go s.Serve(lis)
+
+	c := cgrpc.NewClient()
+	call := func(topic string) (*message.Response, error) {
+		rsp := &message.Response{}
+		req := c.NewRequest(&service.Service{Name: "a", Version: "v1", Topic: topic}, lis.Addr().String(), &message.Payload{})
+		return rsp, c.Call(context.Background(), req, rsp)
+	}
+
+	rsp, err := call("ok")
+	testutils.Ok(t, err)
+	testutils.Assert(t, rsp.GetError() == nil, "no error expected")
+	testutils.Equals(t, `{"topic":"ok"}`, string(rsp.GetBody()))
+
+	// the structured error is carried as it is
+	rsp, err = call("structured")
+	testutils.Ok(t, err)
+	testutils.Equals(t, message.ErrCodeForbidden, rsp.GetError().GetCode())
+	testutils.Equals(t, "trellis/a/v1", rsp.GetError().GetNamespace())
+	testutils.Equals(t, "forbidden", rsp.GetError().GetMessage())
+	testutils.Equals(t, map[string]string{"principal": "u1"}, rsp.GetError().GetDetails())
+	testutils.Equals(t, true, rsp.GetError().GetRetryable())
+
+	// the plain error is unknown error in the namespace of the grpc server
+	rsp, err = call("plain")
+	testutils.Ok(t, err)
+	testutils.Equals(t, message.ErrCodeUnknownError, rsp.GetError().GetCode())
+	testutils.Equals(t, grpcService.TrellisPath(), rsp.GetError().GetNamespace())
+	testutils.Equals(t, "boom", rsp.GetError().GetMessage())
+
+	// the status error of grpc is the retryable error of the remote response
+	s.Stop()
+	_, err = call("ok")
+	mErr, ok := err.(*message.Error)
+	testutils.Assert(t, ok, "status error should be converted into message error: %v", err)
+	testutils.Equals(t, message.ErrCodeRemoteResponse, mErr.GetCode())
+	testutils.Equals(t, lis.Addr().String(), mErr.GetNamespace())
+	testutils.Equals(t, "Unavailable", mErr.GetDetails()["grpc_code"])
+	testutils.Equals(t, true, mErr.GetRetryable())
+}
@@ -18,20 +18,18 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package http
 
 import (
-	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/iTrellis/common/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/iTrellis/trellis/cmd"
-	"github.com/iTrellis/trellis/internal/addr"
-	"github.com/iTrellis/trellis/internal/gin_middlewares"
-	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/internal/metrics"
+	"github.com/iTrellis/trellis/internal/tracing"
+	"github.com/iTrellis/trellis/server/gateway"
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/component"
 	"github.com/iTrellis/trellis/service/message"
@@ -43,32 +41,12 @@ func init() {
 	cmd.DefaultCompManager.RegisterComponentFunc(s, NewHTTPServer)
 }
 
-var handlers = make(map[string]*gin_middlewares.Handler)
-
-// RegistCustomHandlers register customer's handlers
-func RegistCustomHandlers(name, path, method string, fn gin.HandlerFunc) {
-
-	if fn == nil {
-		panic("handler function should not be nil")
-	}
-	_, ok := handlers[name]
-	if ok {
-		panic(fmt.Errorf("handler isalread exists"))
-	}
-
-	handlers[name] = &gin_middlewares.Handler{Name: name, URLPath: path, Method: strings.ToUpper(method), Func: fn}
-}
-
 type httpServer struct {
-	ginMode string
-
-	serverIP string
+	gateway *gateway.Gateway
 
 	forwardHeaders []string
 
 	options component.Options
-
-	srv *http.Server
 }
 
 // NewHTTPServer new api service
@@ -88,49 +66,18 @@ func NewHTTPServer(opts ...component.Option) (component.Component, error) {
 
 func (p *httpServer) init() error {
 
-	ips := addr.ExternalIPs()
-	if len(ips) > 0 {
-		p.serverIP = ips[0]
-	} else {
-		p.serverIP = "unknown server ip"
-	}
-
-	p.ginMode = p.options.Config.GetString("gin_mode")
-
-	gin.SetMode(p.ginMode)
-
-	engine := gin.New()
-
-	engine.Use(gin.Recovery(), gin_middlewares.NewRequestID(), gin_middlewares.StatFunc(p.options.Logger))
-
-	httpConf := p.options.Config.GetValuesConfig("http")
-
-	gin_middlewares.LoadPprof(engine, httpConf.GetValuesConfig("pprof"))
-
-	ginHanlders := []gin.HandlerFunc{}
-
-	if gzipH := gin_middlewares.LoadGZip(httpConf.GetValuesConfig("gzip")); gzipH != nil {
-		ginHanlders = append(ginHanlders, gzipH)
-	}
-
-	ginHanlders = append(ginHanlders, gin_middlewares.LoadCors(httpConf.GetValuesConfig("cors")))
-
-	for _, name := range gin_middlewares.IndexGinFuncs {
-		ginHanlders = append(ginHanlders, gin_middlewares.UseFuncs[name])
+	gw, err := gateway.New(s.TrellisPath(), p.options)
+	if err != nil {
+		return err
 	}
-	engine.Use(ginHanlders...)
+	p.gateway = gw
 
-	urlPath := httpConf.GetString("postapi")
+	urlPath := p.gateway.Conf.GetString("postapi")
 	if len(urlPath) != 0 {
-		engine.POST(urlPath, p.serve)
+		p.gateway.Engine.POST(urlPath, p.serve)
 	}
 
-	p.forwardHeaders = httpConf.GetStringList("forward.headers")
-
-	p.srv = &http.Server{
-		Addr:    httpConf.GetString("address", ":8080"),
-		Handler: engine,
-	}
+	p.forwardHeaders = p.gateway.Conf.GetStringList("forward.headers")
 
 	return nil
 }
@@ -140,100 +87,87 @@ func (p *httpServer) Route(message.Message) (interface{}, error) {
 }
 
 func (p *httpServer) Start() error {
-
-	go func() {
-
-		var err error
-
-		sslConf := p.options.Config.GetValuesConfig("http.ssl")
-
-		if sslConf != nil && sslConf.GetBoolean("enabled", false) {
-			err = p.srv.ListenAndServeTLS(
-				sslConf.GetString("cert-file"),
-				sslConf.GetString("cert-key"),
-			)
-		} else {
-			err = p.srv.ListenAndServe()
-		}
-
-		if err != nil {
-			if err != http.ErrServerClosed {
-				p.options.Logger.Error("failed_listen_and_serve", "err", err.Error())
-				log.Fatalln(err)
-			}
-		}
-	}()
-	return nil
+	return p.gateway.Start()
 }
 
 func (p *httpServer) Stop() error {
-
-	dur := p.options.Config.GetTimeDuration("http.shutdown-timeout", time.Second*30)
-
-	ctx, cancel := context.WithTimeout(context.Background(), dur)
-	defer cancel()
-
-	if err := p.srv.Shutdown(ctx); err != nil {
-		return errors.Newf("api shutdown failure, err: %s", err)
-	}
-	return nil
+	return p.gateway.Stop()
 }
 
 func (p *httpServer) serve(ctx *gin.Context) {
 
-	clientIP := addr.GetClientIP(ctx.Request)
-
 	reqID := ctx.GetHeader(service.HeaderXRequestID)
 
-	r := &server.Response{
-		RequestID: reqID,
-		ClientIP:  clientIP,
-		ServerIP:  p.serverIP,
-	}
+	r := p.gateway.NewResponse(ctx)
 
 	remoteMsg := &message.RemoteMessage{}
 
-	if err := ctx.BindJSON(remoteMsg); err != nil {
-		r.Code = 10
-		r.Msg = fmt.Sprintf("bad request: %s", err.Error())
-		r.Namespace = s.TrellisPath()
-		ctx.JSON(http.StatusBadRequest, r)
-		p.options.Logger.Error("get_raw_data", "err", err)
+	defer func(begin time.Time) {
+		metrics.ServerRequest(p.options.Instance, "", remoteMsg.Service, r.Code, begin)
+	}(time.Now())
+
+	if err := p.gateway.LimitBody(ctx, 0); err != nil {
+		p.gateway.Error(ctx, r, err)
+		p.options.Logger.Warn("request_too_large", "request_id", reqID)
 		return
 	}
 
-	msg := remoteMsg.ToMessage()
+	var msgOpts []message.Option
+	if gateway.IsStreamBody(ctx.GetHeader(service.HeaderContentType)) {
+		// the streamed body is called by the service declared in headers
+		svc, err := streamService(ctx)
+		if err != nil {
+			p.gateway.Error(ctx, r, p.gateway.NewError(message.ErrCodeBadRequest, fmt.Sprintf("bad request: %s", err.Error())))
+			p.options.Logger.Error("get_stream_service", "request_id", reqID, "err", err)
+			return
+		}
+		remoteMsg.Service = svc
+		remoteMsg.Payload = &message.Payload{}
+		remoteMsg.Payload.Set(service.HeaderContentType, ctx.GetHeader(service.HeaderContentType))
+		msgOpts = append(msgOpts, message.BodyReader(ctx.Request.Body))
+	} else if err := ctx.ShouldBindJSON(remoteMsg); err != nil {
+		if _, ok := err.(*message.Error); !ok {
+			err = p.gateway.NewError(message.ErrCodeBadRequest, fmt.Sprintf("bad request: %s", err.Error()))
+		}
+		p.gateway.Error(ctx, r, err)
+		p.options.Logger.Error("get_raw_data", "request_id", reqID, "err", err)
+		return
+	}
 
-	resp, err := p.options.Caller.CallComponent(msg)
-	if err == nil {
-		switch t := resp.(type) {
-		case server.Response:
-			r = &t
-		case *server.Response:
-			r = t
-		default:
-			r.Result = resp
+	if remoteMsg.Payload == nil {
+		remoteMsg.Payload = &message.Payload{}
+	}
+	if !service.ValidRequestID(remoteMsg.Payload.Get(service.HeaderXRequestID)) {
+		remoteMsg.Payload.Set(service.HeaderXRequestID, reqID)
+	}
+
+	_, span := tracing.StartFromPayload(remoteMsg.Payload, "trellis.http "+remoteMsg.Service.TrellisPath(),
+		trace.SpanKindServer, tracing.ServiceAttributes(remoteMsg.Service)...)
+	defer func() {
+		if r.Code != 0 {
+			span.SetStatus(codes.Error, r.Msg)
 		}
+		span.End()
+	}()
 
-		ctx.JSON(200, r)
+	msg := message.NewMessage(append(msgOpts,
+		message.MessagePayload(remoteMsg.Payload), message.Service(remoteMsg.Service))...)
+
+	resp, err := p.options.Caller.CallComponent(msg)
+	if err == nil {
+		p.gateway.Reply(ctx, r, resp)
 		return
 	}
 
-	// errors
-	switch et := err.(type) {
-	case errors.ErrorCode:
-		r.Code = et.Code()
-		r.Msg = et.Error()
-		r.Namespace = et.Namespace()
-	case errors.SimpleError:
-		r.Code = 14
-		r.Msg = et.Error()
-		r.Namespace = et.Namespace()
-	default:
-		r.Code = 15
-		r.Msg = et.Error()
-		r.Namespace = s.TrellisPath()
-	}
+	p.gateway.Error(ctx, r, err)
+}
 
-	ctx.JSON(200, r)
+// streamService the service of the streamed body, X-Service: domain/name/version and X-Topic: topic
+func streamService(ctx *gin.Context) (*service.Service, error) {
+	s, err := service.ParseService("/" + strings.Trim(ctx.GetHeader(service.HeaderXService), "/"))
+	if err != nil {
+		return nil, err
+	}
+	s.Topic = ctx.GetHeader(service.HeaderXTopic)
+	return s, nil
 }
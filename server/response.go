@@ -17,13 +17,160 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 
 package server
 
+import (
+	"net/http"
+
+	"github.com/iTrellis/trellis/service/message"
+)
+
 // Response response
 type Response struct {
-	RequestID string      `json:"request_id"`
-	ClientIP  string      `json:"client_ip"`
-	ServerIP  string      `json:"server_ip"`
-	Code      uint64      `json:"code"`
-	Namespace string      `json:"namespace,omitempty"`
-	Msg       string      `json:"msg,omitempty"`
-	Result    interface{} `json:"result"`
+	RequestID string            `json:"request_id"`
+	ClientIP  string            `json:"client_ip"`
+	ServerIP  string            `json:"server_ip"`
+	Code      uint64            `json:"code"`
+	Namespace string            `json:"namespace,omitempty"`
+	Msg       string            `json:"msg,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+	Result    interface{}       `json:"result"`
+
+	// TraceID & TraceIP the keys of request id and server ip replied by the api server before the shared gateway,
+	// they are emitted along with request_id and server_ip for the existing clients,
+	// deprecated and would be removed in the next major release
+	TraceID string `json:"trace_id,omitempty"`
+	TraceIP string `json:"trace_ip,omitempty"`
+}
+
+// InnerResult result of running component, which is replied with the http code,
+// or redirected to the url if the http code is 301 or 302
+type InnerResult struct {
+	HTTPCode    int
+	RedirectURL string
+	Body        interface{}
+}
+
+// RawResult result of running component, which is replied as it is in the raw response mode,
+// or carried in the result of the envelope
+type RawResult struct {
+	HTTPCode    int
+	ContentType string
+	Header      map[string]string
+	Body        []byte
+}
+
+// StreamResult result streamed by the component, the chunks are replied as server-sent events
+// if the content type is text/event-stream, or written in chunked encoding,
+// the chunk would be Event, []byte, string or the value encoded in json lines
+type StreamResult struct {
+	HTTPCode    int
+	ContentType string
+	Header      map[string]string
+	// Chunks closed by the component once the result is done
+	Chunks <-chan interface{}
+	// Cancel called when the stream is ended, such as the client is gone,
+	// the component should stop sending the chunks
+	Cancel func()
+}
+
+// Event server-sent event, the data is encoded in json if it's not string or []byte
+type Event struct {
+	ID    string
+	Event string
+	Retry uint
+	Data  interface{}
+}
+
+// Problem the error details of rfc 7807, replied with application/problem+json
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      uint64            `json:"code"`
+	Namespace string            `json:"namespace,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// NewProblem the problem of the error in the response, the status is derived from the error code
+func NewProblem(r *Response, instance string) *Problem {
+	status := ProblemStatus(r.Code)
+	return &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    r.Msg,
+		Instance:  instance,
+		Code:      r.Code,
+		Namespace: r.Namespace,
+		Details:   r.Details,
+		Retryable: r.Retryable,
+		RequestID: r.RequestID,
+	}
+}
+
+// SetError flatten the structured error into response
+func (p *Response) SetError(err *message.Error) {
+	if err == nil {
+		return
+	}
+	p.Code = err.GetCode()
+	p.Namespace = err.GetNamespace()
+	p.Msg = err.GetMessage()
+	p.Details = err.GetDetails()
+	p.Retryable = err.GetRetryable()
+}
+
+// GetError get the structured error from response, nil if no error
+func (p *Response) GetError() *message.Error {
+	if p.Code == 0 {
+		return nil
+	}
+	return &message.Error{
+		Code:      p.Code,
+		Namespace: p.Namespace,
+		Message:   p.Msg,
+		Details:   p.Details,
+		Retryable: p.Retryable,
+	}
+}
+
+// ErrorStatus http status of the error code in the envelope responses, which is kept as it was
+// for the existing clients: the bad requests and unknown apis are replied with status 400,
+// and the other errors are carried in the response body with status 200,
+// see ProblemStatus for the statuses of all the errors in the raw and problem modes
+func ErrorStatus(code uint64) int {
+	switch code {
+	case message.ErrCodeBadRequest, message.ErrCodeAPINotFound:
+		return http.StatusBadRequest
+	default:
+		return http.StatusOK
+	}
+}
+
+// ProblemStatus http status of the error code for the problem responses, all errors are mapped
+func ProblemStatus(code uint64) int {
+	switch code {
+	case 0:
+		return http.StatusOK
+	case message.ErrCodeBadRequest:
+		return http.StatusBadRequest
+	case message.ErrCodeAPINotFound, message.ErrCodeUnknownTopic:
+		return http.StatusNotFound
+	case message.ErrCodeTooManyRequests:
+		return http.StatusTooManyRequests
+	case message.ErrCodeUnauthorized:
+		return http.StatusUnauthorized
+	case message.ErrCodeForbidden:
+		return http.StatusForbidden
+	case message.ErrCodeRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case message.ErrCodeRemoteResponse:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
 }
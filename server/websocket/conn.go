@@ -0,0 +1,125 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package websocket
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/iTrellis/trellis/server/auth"
+)
+
+// conn the websocket connection, the frames are written by the write pump from the send queue
+type conn struct {
+	id string
+	ws *websocket.Conn
+
+	// principal authenticated when the connection is upgraded, nil if anonymous
+	principal *auth.Principal
+	// header the payload headers of the calls from the connection, such as the client ip and the principal
+	header map[string]string
+	// requestHeader the header of the upgrade request, which the rate limits and the traffic splits are keyed by
+	requestHeader http.Header
+
+	send chan []byte
+	done chan struct{}
+
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+
+	// groups guarded by the hub
+	groups map[string]struct{}
+}
+
+func newConn(id string, ws *websocket.Conn, queueSize int) *conn {
+	return &conn{
+		id:     id,
+		ws:     ws,
+		header: make(map[string]string),
+		send:   make(chan []byte, queueSize),
+		done:   make(chan struct{}),
+		groups: make(map[string]struct{}),
+	}
+}
+
+// enqueue the frame into the send queue, the slow connection whose queue is full is closed
+func (p *conn) enqueue(data []byte) bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+
+	select {
+	case p.send <- data:
+		return true
+	default:
+		p.close(websocket.CloseTryAgainLater, "send queue is full")
+		return false
+	}
+}
+
+// close the connection with the close code, the close message is written by the write pump
+func (p *conn) close(code int, text string) {
+	p.closeOnce.Do(func() {
+		p.closeCode, p.closeText = code, text
+		close(p.done)
+	})
+}
+
+func (p *conn) closed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// writePump write the queued frames and the pings until the connection is closed
+func (p *conn) writePump(pingInterval, writeTimeout time.Duration) error {
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		p.ws.Close()
+	}()
+
+	for {
+		select {
+		case data := <-p.send:
+			p.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := p.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				p.close(websocket.CloseAbnormalClosure, "")
+				return err
+			}
+		case <-ticker.C:
+			p.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := p.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				p.close(websocket.CloseAbnormalClosure, "")
+				return err
+			}
+		case <-p.done:
+			return p.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(p.closeCode, p.closeText), time.Now().Add(writeTimeout))
+		}
+	}
+}
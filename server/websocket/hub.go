@@ -0,0 +1,152 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package websocket
+
+import (
+	"fmt"
+	"sync"
+)
+
+// hub the connections and the groups of the connections
+type hub struct {
+	sync.RWMutex
+
+	maxConns int
+	conns    map[string]*conn
+	groups   map[string]map[string]*conn
+}
+
+func newHub(maxConns int) *hub {
+	return &hub{
+		maxConns: maxConns,
+		conns:    make(map[string]*conn),
+		groups:   make(map[string]map[string]*conn),
+	}
+}
+
+// add the connection, false if the connections are up to the limit
+func (p *hub) add(c *conn) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.maxConns > 0 && len(p.conns) >= p.maxConns {
+		return false
+	}
+	p.conns[c.id] = c
+	return true
+}
+
+// remove the connection and its groups
+func (p *hub) remove(c *conn) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.conns, c.id)
+	for group := range c.groups {
+		p.leaveGroup(c, group)
+	}
+}
+
+func (p *hub) get(id string) (*conn, bool) {
+	p.RLock()
+	c, ok := p.conns[id]
+	p.RUnlock()
+	return c, ok
+}
+
+func (p *hub) len() int {
+	p.RLock()
+	defer p.RUnlock()
+	return len(p.conns)
+}
+
+// join the connection into the group
+func (p *hub) join(id, group string) error {
+	p.Lock()
+	defer p.Unlock()
+	c, ok := p.conns[id]
+	if !ok {
+		return fmt.Errorf("connection not found: %s", id)
+	}
+
+	members, ok := p.groups[group]
+	if !ok {
+		members = make(map[string]*conn)
+		p.groups[group] = members
+	}
+	members[id] = c
+	c.groups[group] = struct{}{}
+	return nil
+}
+
+// leave the group, the empty group is removed
+func (p *hub) leave(id, group string) {
+	p.Lock()
+	defer p.Unlock()
+	if c, ok := p.conns[id]; ok {
+		p.leaveGroup(c, group)
+	}
+}
+
+func (p *hub) leaveGroup(c *conn, group string) {
+	delete(c.groups, group)
+	members := p.groups[group]
+	delete(members, c.id)
+	if len(members) == 0 {
+		delete(p.groups, group)
+	}
+}
+
+// push the frame to the connections and the members of the group,
+// returns the number of the connections which the frame is queued to
+func (p *hub) push(ids []string, group string, data []byte) int {
+	targets := make(map[string]*conn)
+
+	p.RLock()
+	for _, id := range ids {
+		if c, ok := p.conns[id]; ok {
+			targets[id] = c
+		}
+	}
+	if group != "" {
+		for id, c := range p.groups[group] {
+			targets[id] = c
+		}
+	}
+	p.RUnlock()
+
+	sent := 0
+	for _, c := range targets {
+		if c.enqueue(data) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// closeAll close all the connections, such as the server is stopping
+func (p *hub) closeAll(code int, text string) {
+	p.RLock()
+	conns := make([]*conn, 0, len(p.conns))
+	for _, c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.RUnlock()
+
+	for _, c := range conns {
+		c.close(code, text)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package websocket
+
+import (
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+)
+
+func TestHub(t *testing.T) {
+	h := newHub(2)
+
+	a, b, c := newConn("a", nil, 1), newConn("b", nil, 1), newConn("c", nil, 1)
+	testutils.Equals(t, true, h.add(a))
+	testutils.Equals(t, true, h.add(b))
+	testutils.Equals(t, false, h.add(c))
+
+	testutils.Ok(t, h.join("a", "room"))
+	testutils.Ok(t, h.join("b", "room"))
+	testutils.NotOk(t, h.join("c", "room"))
+
+	// a is both in the ids and the group
+	testutils.Equals(t, 2, h.push([]string{"a", "c"}, "room", []byte("1")))
+	testutils.Equals(t, "1", string(<-a.send))
+
+	// the send queue of b is full, so b is closed as a slow connection
+	testutils.Equals(t, 1, h.push(nil, "room", []byte("2")))
+	testutils.Equals(t, true, b.closed())
+	testutils.Equals(t, 0, h.push([]string{"b"}, "", []byte("3")))
+
+	h.remove(b)
+	h.leave("a", "room")
+	testutils.Equals(t, 0, len(h.groups))
+	testutils.Equals(t, 1, h.len())
+
+	h.closeAll(1001, "")
+	testutils.Equals(t, true, a.closed())
+}
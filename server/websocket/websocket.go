@@ -0,0 +1,490 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/iTrellis/trellis/cmd"
+	"github.com/iTrellis/trellis/internal/addr"
+	"github.com/iTrellis/trellis/internal/metrics"
+	"github.com/iTrellis/trellis/server"
+	"github.com/iTrellis/trellis/server/api"
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+var wsService = &service.Service{Name: "trellis-server-websocket", Version: "v1"}
+
+func init() {
+	cmd.DefaultCompManager.RegisterComponentFunc(wsService, NewWebsocketServer)
+}
+
+// topics of the websocket server, which are called by the components to push messages to the connections
+const (
+	// TopicPush push the message to the connections or the group, request is PushRequest
+	TopicPush = "push"
+	// TopicJoin join the connection into the group, request is GroupRequest
+	TopicJoin = "join"
+	// TopicLeave the connection leaves the group, request is GroupRequest
+	TopicLeave = "leave"
+	// TopicClose close the connection, request is CloseRequest
+	TopicClose = "close"
+)
+
+// Frame the json message between the clients and the server,
+// the requests carry id, api and body, the replies carry id, api and the result or the error,
+// and the pushed messages carry event and result.
+// The frames are called through the same rate limits, auth, schemas and traffic splits as the api server,
+// but the response_mode and the cache of the apis are not applied, the results are always replied in the frames,
+// and the apis replying streamed results are not supported
+type Frame struct {
+	ID    string          `json:"id,omitempty"`
+	API   string          `json:"api,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Body  json.RawMessage `json:"body,omitempty"`
+
+	Code      uint64            `json:"code,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Msg       string            `json:"msg,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+	Result    interface{}       `json:"result,omitempty"`
+}
+
+// PushRequest push the event to the connections and the members of the group
+type PushRequest struct {
+	ConnectionIDs []string        `json:"connection_ids"`
+	Group         string          `json:"group"`
+	Event         string          `json:"event"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// PushResponse the number of the connections which the event is queued to
+type PushResponse struct {
+	Sent int `json:"sent"`
+}
+
+// GroupRequest the connection joins or leaves the group
+type GroupRequest struct {
+	ConnectionID string `json:"connection_id"`
+	Group        string `json:"group"`
+}
+
+// CloseRequest close the connection with the reason
+type CloseRequest struct {
+	ConnectionID string `json:"connection_id"`
+	Reason       string `json:"reason"`
+}
+
+type wsServer struct {
+	*component.Router
+
+	gateway  *gateway.Gateway
+	upgrader websocket.Upgrader
+	hub      *hub
+
+	readLimit    int64
+	queueSize    int
+	maxInFlight  int
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// pipeline the rate limits, auth, schemas and traffic splits of the apis
+	pipeline *api.Pipeline
+	store    api.APIStore
+
+	options component.Options
+}
+
+// NewWebsocketServer new websocket server, the frames of the connections are called by the apis
+func NewWebsocketServer(opts ...component.Option) (component.Component, error) {
+	s := &wsServer{
+		Router: component.NewRouter(),
+	}
+
+	for _, o := range opts {
+		o(&s.options)
+	}
+
+	err := s.init()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (p *wsServer) init() error {
+	gw, err := gateway.New(wsService.TrellisPath(), p.options)
+	if err != nil {
+		return err
+	}
+	p.gateway = gw
+
+	conf := gw.Conf
+	p.hub = newHub(conf.GetInt("websocket.max_connections", 10000))
+	p.readLimit = int64(conf.GetInt("websocket.read_limit", 64*1024))
+	p.queueSize = conf.GetInt("websocket.queue_size", 256)
+	p.maxInFlight = conf.GetInt("websocket.max_in_flight", 16)
+	p.pingInterval = conf.GetTimeDuration("websocket.ping_interval", 30*time.Second)
+	p.pongTimeout = conf.GetTimeDuration("websocket.pong_timeout", 60*time.Second)
+	p.writeTimeout = conf.GetTimeDuration("websocket.write_timeout", 10*time.Second)
+
+	p.upgrader = websocket.Upgrader{
+		ReadBufferSize:  conf.GetInt("websocket.read_buffer_size", 4096),
+		WriteBufferSize: conf.GetInt("websocket.write_buffer_size", 4096),
+	}
+	if origins := conf.GetStringList("websocket.allowed_origins"); len(origins) != 0 {
+		p.upgrader.CheckOrigin = checkOrigin(origins)
+	}
+
+	pipeline, err := api.NewPipeline(gw, p.options.Logger)
+	if err != nil {
+		return err
+	}
+	p.pipeline = pipeline
+
+	for topic, fn := range map[string]interface{}{
+		TopicPush:  p.push,
+		TopicJoin:  p.join,
+		TopicLeave: p.leave,
+		TopicClose: p.close,
+	} {
+		if err := p.HandleFunc(topic, fn); err != nil {
+			return err
+		}
+	}
+
+	apisConf := p.options.Config.GetValuesConfig("apis")
+	if apisConf == nil {
+		return fmt.Errorf("apis config not found")
+	}
+
+	store, err := api.NewAPIStore(apisConf, p.options)
+	if err != nil {
+		return err
+	}
+
+	apis, err := store.Load()
+	if err != nil {
+		store.Stop()
+		return err
+	}
+	p.pipeline.SetAPIs(apis)
+	p.store = store
+
+	gw.Engine.GET(conf.GetString("websocket.path", "/ws"), p.serveWS)
+
+	return nil
+}
+
+// checkOrigin allow the origins of the list, * allows any origin
+func checkOrigin(origins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get(service.HeaderOrigin)
+		for _, o := range origins {
+			if o == "*" || o == origin {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (p *wsServer) Start() error {
+	// the changes of apis are watched until the server is stopped
+	p.store.Watch(p.pipeline.SetAPIs)
+
+	return p.gateway.Start()
+}
+
+func (p *wsServer) Stop() error {
+	// the hijacked connections are not closed by the http server
+	p.hub.closeAll(websocket.CloseGoingAway, "server is stopping")
+
+	var errs []string
+	if err := p.gateway.Stop(); err != nil {
+		errs = append(errs, fmt.Sprintf("gateway stop failure, err: %s", err))
+	}
+
+	if err := p.store.Stop(); err != nil {
+		errs = append(errs, fmt.Sprintf("api store stop failure, err: %s", err))
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// serveWS upgrade the request into websocket connection
+func (p *wsServer) serveWS(gCtx *gin.Context) {
+	r := p.gateway.NewResponse(gCtx)
+
+	// the rejected upgrades are replied in problem+json, so that the handshake fails with the http status
+	principal, err := p.pipeline.Authenticate(gCtx.Request)
+	if err != nil {
+		p.gateway.ErrorAs(gCtx, gateway.ResponseModeProblem, r, err)
+		p.options.Logger.Warn("auth_failed", "request_id", r.RequestID, "client_ip", r.ClientIP, "err", err.Error())
+		return
+	}
+
+	if p.hub.maxConns > 0 && p.hub.len() >= p.hub.maxConns {
+		p.gateway.ErrorAs(gCtx, gateway.ResponseModeProblem, r,
+			p.gateway.NewError(message.ErrCodeTooManyRequests, "too many connections").SetRetryable(true))
+		p.options.Logger.Warn("too_many_connections", "request_id", r.RequestID, "client_ip", r.ClientIP)
+		return
+	}
+
+	// the upgrader replies the http error if it's failed
+	ws, err := p.upgrader.Upgrade(gCtx.Writer, gCtx.Request, nil)
+	if err != nil {
+		p.options.Logger.Warn("websocket_upgrade_failed", "request_id", r.RequestID, "client_ip", r.ClientIP,
+			"err", err.Error())
+		return
+	}
+
+	c := newConn(uuid.NewString(), ws, p.queueSize)
+	c.principal = principal
+	c.requestHeader = gCtx.Request.Header.Clone()
+	c.header[service.HeaderXClientIP] = addr.GetClientIP(gCtx.Request)
+	principal.SetPayload(&message.Payload{Header: c.header})
+
+	if !p.hub.add(c) {
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many connections"),
+			time.Now().Add(p.writeTimeout))
+		ws.Close()
+		return
+	}
+
+	p.options.Logger.Info("websocket_connected", "connection_id", c.id, "request_id", r.RequestID,
+		"client_ip", r.ClientIP)
+
+	go func() {
+		if err := c.writePump(p.pingInterval, p.writeTimeout); err != nil {
+			p.options.Logger.Debug("websocket_write_failed", "connection_id", c.id, "err", err.Error())
+		}
+	}()
+	go p.readPump(c)
+}
+
+// readPump read the frames and call the components, the frames are not read while the calls are up to
+// max_in_flight, so the clients sending too fast are blocked by the tcp flow control
+func (p *wsServer) readPump(c *conn) {
+	defer func() {
+		p.hub.remove(c)
+		c.close(websocket.CloseNormalClosure, "")
+		p.options.Logger.Info("websocket_disconnected", "connection_id", c.id)
+	}()
+
+	c.ws.SetReadLimit(p.readLimit)
+	c.ws.SetReadDeadline(time.Now().Add(p.pongTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(p.pongTimeout))
+	})
+
+	inFlight := make(chan struct{}, p.maxInFlight)
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if !c.closed() && websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				p.options.Logger.Warn("websocket_read_failed", "connection_id", c.id, "err", err.Error())
+			}
+			return
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		case <-c.done:
+			return
+		}
+		// the pongs are not read while waiting for the calls
+		c.ws.SetReadDeadline(time.Now().Add(p.pongTimeout))
+
+		go func() {
+			defer func() { <-inFlight }()
+			p.call(c, data)
+		}()
+	}
+}
+
+// call the component of the frame's api, and reply the result with the id of the frame
+func (p *wsServer) call(c *conn, data []byte) {
+	frame := &Frame{}
+	if err := json.Unmarshal(data, frame); err != nil {
+		p.reply(c, &Frame{}, nil, p.gateway.NewError(message.ErrCodeBadRequest,
+			fmt.Sprintf("bad request: %s", err.Error())))
+		return
+	}
+
+	a, ok := p.pipeline.GetAPI(frame.API)
+
+	apiLabel := frame.API
+	if !ok {
+		apiLabel = metrics.UnknownAPI
+	}
+
+	var msgService *service.Service
+	reply := &Frame{ID: frame.ID, API: frame.API}
+	defer func(begin time.Time) {
+		metrics.ServerRequest(p.options.Instance, apiLabel, msgService, reply.Code, begin)
+	}(time.Now())
+
+	if !ok {
+		p.reply(c, reply, nil, p.gateway.NewError(message.ErrCodeAPINotFound, "api not found"))
+		return
+	}
+
+	if err := p.pipeline.Allow(a, c.header[service.HeaderXClientIP], c.requestHeader); err != nil {
+		p.reply(c, reply, nil, err)
+		p.options.Logger.Warn("rate_limited", "connection_id", c.id, "api_name", frame.API, "err", err.Error())
+		return
+	}
+
+	if err := p.pipeline.Authorize(c.principal, a); err != nil {
+		p.reply(c, reply, nil, err)
+		return
+	}
+
+	if err := p.pipeline.ValidateRequest(a, frame.Body); err != nil {
+		p.reply(c, reply, nil, err)
+		return
+	}
+
+	payload := &message.Payload{Header: make(map[string]string), Body: frame.Body}
+	for k, v := range c.header {
+		payload.Set(k, v)
+	}
+	reqID := frame.ID
+	if !service.ValidRequestID(reqID) {
+		reqID = uuid.NewString()
+	}
+	payload.Set(service.HeaderXRequestID, reqID)
+	payload.Set(service.HeaderXConnectionID, c.id)
+
+	msgService = &service.Service{
+		Domain:  a.ServiceDomain,
+		Name:    a.ServiceName,
+		Version: p.pipeline.ServiceVersion(a, c.requestHeader),
+		Topic:   a.Topic}
+
+	resp, err := p.options.Caller.CallComponent(
+		message.NewMessage(message.Service(msgService), message.MessagePayload(payload)))
+	if sr, ok := resp.(*server.StreamResult); ok && err == nil {
+		// the chunks could not be replied in one frame
+		if sr.Cancel != nil {
+			sr.Cancel()
+		}
+		resp, err = nil, p.gateway.NewError(message.ErrCodeInvalidResponse, "streamed result is not supported by websocket")
+	}
+	if err == nil {
+		err = p.pipeline.ValidateResponse(a, resp)
+	}
+	if err != nil {
+		p.options.Logger.Error("call_server_failed", "request_id", reqID, "connection_id", c.id,
+			"api_name", frame.API, "err", err.Error())
+	}
+	p.reply(c, reply, resp, err)
+}
+
+// reply the result or the error in the frame
+func (p *wsServer) reply(c *conn, f *Frame, resp interface{}, err error) {
+	if err != nil {
+		mErr := message.FromError(err, p.gateway.Namespace)
+		f.Code, f.Namespace, f.Msg = mErr.GetCode(), mErr.GetNamespace(), mErr.GetMessage()
+		f.Details, f.Retryable = mErr.GetDetails(), mErr.GetRetryable()
+	} else {
+		f.Result = frameResult(resp)
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		p.options.Logger.Error("marshal_frame_failed", "connection_id", c.id, "api_name", f.API, "err", err.Error())
+		return
+	}
+	c.enqueue(data)
+}
+
+// frameResult the result replied in the frame, the raw bodies are replied as json if the content type is json,
+// otherwise as string
+func frameResult(resp interface{}) interface{} {
+	switch t := resp.(type) {
+	case server.InnerResult:
+		return t.Body
+	case *server.InnerResult:
+		return t.Body
+	case server.RawResult:
+		return rawResult(&t)
+	case *server.RawResult:
+		return rawResult(t)
+	default:
+		return resp
+	}
+}
+
+func rawResult(r *server.RawResult) interface{} {
+	if strings.HasPrefix(r.ContentType, service.MIMEApplicationJSON) && json.Valid(r.Body) {
+		return json.RawMessage(r.Body)
+	}
+	return string(r.Body)
+}
+
+func (p *wsServer) push(req *PushRequest) (*PushResponse, error) {
+	data, err := json.Marshal(&Frame{Event: req.Event, Result: req.Data})
+	if err != nil {
+		return nil, p.gateway.NewError(message.ErrCodeBadRequest, fmt.Sprintf("bad request: %s", err.Error()))
+	}
+	return &PushResponse{Sent: p.hub.push(req.ConnectionIDs, req.Group, data)}, nil
+}
+
+func (p *wsServer) join(req *GroupRequest) (bool, error) {
+	if req.Group == "" {
+		return false, p.gateway.NewError(message.ErrCodeBadRequest, "group is empty")
+	}
+	if err := p.hub.join(req.ConnectionID, req.Group); err != nil {
+		return false, p.gateway.NewError(message.ErrCodeBadRequest, err.Error())
+	}
+	return true, nil
+}
+
+func (p *wsServer) leave(req *GroupRequest) (bool, error) {
+	p.hub.leave(req.ConnectionID, req.Group)
+	return true, nil
+}
+
+func (p *wsServer) close(req *CloseRequest) (bool, error) {
+	c, ok := p.hub.get(req.ConnectionID)
+	if !ok {
+		return false, nil
+	}
+	c.close(websocket.CloseNormalClosure, req.Reason)
+	return true, nil
+}
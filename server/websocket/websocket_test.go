@@ -0,0 +1,140 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/iTrellis/common/logger"
+	"github.com/iTrellis/common/testutils"
+	"github.com/iTrellis/config"
+
+	"github.com/iTrellis/trellis/server/api"
+	"github.com/iTrellis/trellis/server/gateway"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/component"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+type nopLogger struct{ logger.Logger }
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// echoCaller reply the body of the frame, and send the connection id of the call
+type echoCaller struct {
+	connIDs chan string
+}
+
+func (p *echoCaller) CallComponent(msg message.Message) (interface{}, error) {
+	p.connIDs <- msg.GetPayload().Get(service.HeaderXConnectionID)
+	return json.RawMessage(msg.GetPayload().GetBody()), nil
+}
+
+func TestWebsocketServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	gw := &gateway.Gateway{
+		Namespace: wsService.TrellisPath(),
+		Conf: config.Options{
+			"auth": map[string]interface{}{
+				"enabled": true,
+				"authenticators": map[string]interface{}{
+					"token": map[string]interface{}{
+						"type":   "token",
+						"tokens": map[string]interface{}{"client_a": map[string]interface{}{"secret": "secret_a"}},
+					},
+				},
+			},
+		}.ToConfig(),
+	}
+	pipeline, err := api.NewPipeline(gw, nopLogger{})
+	testutils.Ok(t, err)
+	pipeline.SetAPIs(map[string]*api.API{
+		"chat.say": {Name: "chat.say", ServiceName: "component_chat", ServiceVersion: "v1", Topic: "say"},
+	})
+
+	caller := &echoCaller{connIDs: make(chan string, 1)}
+	p := &wsServer{
+		Router:       component.NewRouter(),
+		gateway:      gw,
+		hub:          newHub(10),
+		readLimit:    4096,
+		queueSize:    8,
+		maxInFlight:  1,
+		pingInterval: time.Minute,
+		pongTimeout:  time.Minute,
+		writeTimeout: time.Second,
+		pipeline:     pipeline,
+		options:      component.Options{Caller: caller, Logger: nopLogger{}},
+	}
+
+	engine := gin.New()
+	engine.GET("/ws", p.serveWS)
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	dial := func(header http.Header) *websocket.Conn {
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", header)
+		testutils.Ok(t, err)
+		return ws
+	}
+	read := func(ws *websocket.Conn) *Frame {
+		f := &Frame{}
+		testutils.Ok(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+		testutils.Ok(t, ws.ReadJSON(f))
+		return f
+	}
+
+	header := http.Header{}
+	header.Set(service.HeaderXAPIToken, "secret_a")
+	ws := dial(header)
+	defer ws.Close()
+
+	testutils.Ok(t, ws.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","api":"chat.say","body":{"text":"hi"}}`)))
+	reply := read(ws)
+	testutils.Equals(t, "1", reply.ID)
+	testutils.Equals(t, uint64(0), reply.Code)
+	testutils.Equals(t, map[string]interface{}{"text": "hi"}, reply.Result)
+
+	// the api is not anonymous
+	anonymous := dial(nil)
+	defer anonymous.Close()
+
+	testutils.Ok(t, anonymous.WriteMessage(websocket.TextMessage, []byte(`{"id":"2","api":"chat.say"}`)))
+	reply = read(anonymous)
+	testutils.Equals(t, "2", reply.ID)
+	testutils.Equals(t, uint64(message.ErrCodeUnauthorized), reply.Code)
+
+	resp, err := p.push(&PushRequest{ConnectionIDs: []string{<-caller.connIDs}, Event: "said", Data: json.RawMessage(`"hi"`)})
+	testutils.Ok(t, err)
+	testutils.Equals(t, 1, resp.Sent)
+
+	push := read(ws)
+	testutils.Equals(t, "said", push.Event)
+	testutils.Equals(t, "hi", push.Result)
+}
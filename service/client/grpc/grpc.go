@@ -2,12 +2,22 @@ package grpc
 
 import (
 	"context"
+	"fmt"
 	"sync/atomic"
 
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/client"
+	"github.com/iTrellis/trellis/service/message"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
+// methodCall the full method name of trellis grpc server's Call
+const methodCall = "/grpc.Client/Call"
+
 type grpcClient struct {
 	opts client.Options
 	pool *pool
@@ -33,6 +43,7 @@ func newClient(opts ...client.Option) client.Client {
 	rc.once.Store(false)
 
 	rc.pool = newPool(options.PoolSize, options.PoolTTL, rc.poolMaxIdle(), rc.poolMaxStreams())
+	defaultPoolCollector.add(rc.pool)
 
 	c := client.Client(rc)
 
@@ -45,7 +56,47 @@ func newClient(opts ...client.Option) client.Client {
 }
 
 func (p *grpcClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
-	return nil
+	payload, ok := req.Body().(*message.Payload)
+	if !ok {
+		return fmt.Errorf("unsupported request body: %T", req.Body())
+	}
+
+	out, ok := rsp.(*message.Response)
+	if !ok {
+		return fmt.Errorf("unsupported response: %T", rsp)
+	}
+
+	cc, err := p.pool.getConn(req.Endpoint(), p.transportSecurity(),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(DefaultMaxRecvMsgSize),
+			grpc.MaxCallSendMsgSize(DefaultMaxSendMsgSize),
+		),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = cc.Invoke(ctx, req.Method(), &message.Request{Service: req.Service(), Payload: payload}, out)
+	p.pool.release(req.Endpoint(), cc, err)
+
+	return fromStatus(err, req.Endpoint())
+}
+
+// fromStatus convert the status error of grpc into the error of the remote response,
+// the errors of the components are carried in the response instead
+func fromStatus(err error, endpoint string) error {
+	st, ok := status.FromError(err)
+	if !ok || st == nil {
+		return err
+	}
+
+	retryable := false
+	switch st.Code() {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		retryable = true
+	}
+	return message.NewError(message.ErrCodeRemoteResponse, endpoint, st.Message()).
+		SetDetail("grpc_code", st.Code().String()).SetRetryable(retryable)
 }
 
 func (p *grpcClient) NewMessage(msg interface{}, opts ...client.MessageOption) client.Message {
@@ -53,7 +104,7 @@ func (p *grpcClient) NewMessage(msg interface{}, opts ...client.MessageOption) c
 }
 
 func (p *grpcClient) NewRequest(service *service.Service, endpoint string, req interface{}, reqOpts ...client.RequestOption) client.Request {
-	return nil
+	return newGRPCRequest(service, endpoint, req, p.opts.ContentType, reqOpts...)
 }
 
 func (p *grpcClient) Publish(ctx context.Context, msg client.Message, opts ...client.PublishOption) error {
@@ -68,6 +119,16 @@ func (p *grpcClient) String() string {
 	return "grpc"
 }
 
+// transportSecurity the transport credentials of the connections, insecure if not set
+func (p *grpcClient) transportSecurity() grpc.DialOption {
+	if p.opts.Context != nil {
+		if creds, ok := p.opts.Context.Value(transportCredentials{}).(credentials.TransportCredentials); ok {
+			return grpc.WithTransportCredentials(creds)
+		}
+	}
+	return grpc.WithInsecure()
+}
+
 func (p *grpcClient) poolMaxIdle() int {
 	if p.opts.Context == nil {
 		return DefaultPoolMaxIdle
@@ -0,0 +1,64 @@
+package grpc
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolConnsDesc = prometheus.NewDesc("trellis_grpc_pool_conns",
+		"Number of the connections in the grpc pools.", []string{"addr"}, nil)
+	poolIdleDesc = prometheus.NewDesc("trellis_grpc_pool_idle_conns",
+		"Number of the idle connections in the grpc pools.", []string{"addr"}, nil)
+	poolStreamsDesc = prometheus.NewDesc("trellis_grpc_pool_streams",
+		"Number of the streams in use of the grpc pools.", []string{"addr"}, nil)
+)
+
+// poolCollector collects the stats of all the pools of grpc clients
+type poolCollector struct {
+	sync.Mutex
+	pools []*pool
+}
+
+var defaultPoolCollector = &poolCollector{}
+
+func init() {
+	prometheus.MustRegister(defaultPoolCollector)
+}
+
+func (p *poolCollector) add(pl *pool) {
+	p.Lock()
+	p.pools = append(p.pools, pl)
+	p.Unlock()
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolConnsDesc
+	ch <- poolIdleDesc
+	ch <- poolStreamsDesc
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	p.Lock()
+	pools := append([]*pool{}, p.pools...)
+	p.Unlock()
+
+	// different clients may connect to the same address
+	stats := make(map[string]poolStats)
+	for _, pl := range pools {
+		for addr, st := range pl.stats() {
+			total := stats[addr]
+			total.conns += st.conns
+			total.idle += st.idle
+			total.streams += st.streams
+			stats[addr] = total
+		}
+	}
+
+	for addr, st := range stats {
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(st.conns), addr)
+		ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(st.idle), addr)
+		ch <- prometheus.MustNewConstMetric(poolStreamsDesc, prometheus.GaugeValue, float64(st.streams), addr)
+	}
+}
@@ -1,5 +1,13 @@
 package grpc
 
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/iTrellis/trellis/service/client"
+)
+
 var (
 	// DefaultPoolMaxStreams maximum streams on a connectioin
 	// (20)
@@ -20,3 +28,14 @@ var (
 
 type poolMaxStreams struct{}
 type poolMaxIdle struct{}
+type transportCredentials struct{}
+
+// TransportCredentials the credentials of the connections, such as credentials.NewTLS, default insecure
+func TransportCredentials(creds credentials.TransportCredentials) client.Option {
+	return func(o *client.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, transportCredentials{}, creds)
+	}
+}
@@ -232,3 +232,28 @@ func addConnAfter(conn *poolConn, after *poolConn) {
 	conn.sp.count++
 	return
 }
+
+// poolStats stats of the connections to the address
+type poolStats struct {
+	conns   int
+	idle    int
+	streams int
+}
+
+func (p *pool) stats() map[string]poolStats {
+	p.Lock()
+	defer p.Unlock()
+
+	stats := make(map[string]poolStats, len(p.conns))
+	for addr, sp := range p.conns {
+		st := poolStats{conns: sp.count, idle: sp.idle}
+		for conn := sp.head.next; conn != nil; conn = conn.next {
+			st.streams += conn.streams
+		}
+		for conn := sp.busy.next; conn != nil; conn = conn.next {
+			st.streams += conn.streams
+		}
+		stats[addr] = st
+	}
+	return stats
+}
@@ -0,0 +1,64 @@
+package grpc
+
+import (
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/client"
+	"github.com/iTrellis/trellis/service/codec"
+)
+
+type grpcRequest struct {
+	service     *service.Service
+	endpoint    string
+	contentType string
+	body        interface{}
+	opts        client.RequestOptions
+}
+
+func newGRPCRequest(s *service.Service, endpoint string, req interface{}, contentType string,
+	reqOpts ...client.RequestOption) client.Request {
+	var opts client.RequestOptions
+	for _, o := range reqOpts {
+		o(&opts)
+	}
+
+	// set the content-type specified
+	if len(opts.ContentType) > 0 {
+		contentType = opts.ContentType
+	}
+
+	return &grpcRequest{
+		service:     s,
+		endpoint:    endpoint,
+		contentType: contentType,
+		body:        req,
+		opts:        opts,
+	}
+}
+
+func (p *grpcRequest) Service() *service.Service {
+	return p.service
+}
+
+func (p *grpcRequest) Method() string {
+	return methodCall
+}
+
+func (p *grpcRequest) Endpoint() string {
+	return p.endpoint
+}
+
+func (p *grpcRequest) ContentType() string {
+	return p.contentType
+}
+
+func (p *grpcRequest) Body() interface{} {
+	return p.body
+}
+
+func (p *grpcRequest) Codec() codec.Codec {
+	return nil
+}
+
+func (p *grpcRequest) Stream() bool {
+	return p.opts.Stream
+}
@@ -18,8 +18,11 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package component
 
 import (
+	"time"
+
 	"github.com/iTrellis/common/logger"
 	"github.com/iTrellis/config"
+	"github.com/iTrellis/node"
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/message"
 )
@@ -33,6 +36,14 @@ type Handler func(message.Message) (interface{}, error)
 // Middleware middlerwares for next handler
 type Middleware func(Handler) Handler
 
+// Chain wrap the handler with middlewares, the first middleware is the outermost one
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
 // Component Component
 type Component interface {
 	service.LifeCycle
@@ -40,12 +51,45 @@ type Component interface {
 	Route(msg message.Message) (interface{}, error)
 }
 
+// Dependent component which should be started after it's dependencies
+type Dependent interface {
+	Dependencies() []*service.Service
+}
+
+// NodeLister component which could list the nodes of it's service, such as remote component
+type NodeLister interface {
+	Nodes() []*node.Node
+}
+
 // Describe description of component
 type Describe struct {
-	Name         string
-	RegisterFunc string
-	Component    Component
-	Started      bool
+	// instance name of the component
+	Name    string           `json:"name"`
+	Service *service.Service `json:"service"`
+	// name of the function which newed the component
+	RegisterFunc string `json:"register_func,omitempty"`
+	// type of the component instance
+	Type      string        `json:"type,omitempty"`
+	Component Component     `json:"-"`
+	Started   bool          `json:"started"`
+	State     State         `json:"state"`
+	Logger    logger.Logger `json:"-"`
+
+	// trellis paths of the components which should be started before this one
+	Dependencies []string      `json:"dependencies,omitempty"`
+	StartTimeout time.Duration `json:"start_timeout,omitempty"`
+	StopTimeout  time.Duration `json:"stop_timeout,omitempty"`
+
+	// where the component's options come from, such as project.services.xxx
+	ConfigSource string `json:"config_source,omitempty"`
+	// registry which the service is registered into, or watched from if it is remote
+	Registry string `json:"registry,omitempty"`
+	Remote   bool   `json:"remote"`
+
+	StartedAt time.Time     `json:"started_at,omitempty"`
+	Uptime    time.Duration `json:"uptime,omitempty"`
+
+	Nodes []*node.Node `json:"nodes,omitempty"`
 }
 
 // Option 处理参数函数
@@ -53,9 +97,38 @@ type Option func(*Options)
 
 // Options 参数对象
 type Options struct {
-	Logger logger.Logger
-	Config config.Config
-	Caller message.Caller
+	Instance    string
+	Logger      logger.Logger
+	Config      config.Config
+	Caller      message.Caller
+	CompManager Manager
+
+	Dependencies []*service.Service
+	StartTimeout time.Duration
+	StopTimeout  time.Duration
+
+	ConfigSource string
+	Registry     string
+
+	// ProjectConfig the whole configuration of the project
+	ProjectConfig config.Config
+}
+
+// InstanceService the identity of the component instance, which is used for calling, middlewares and registry,
+// the default instance is identified by the service itself,
+// the named instance is identified by the service named with the instance name, such as /trellis/admin/v1
+func InstanceService(s *service.Service, instance string) *service.Service {
+	if instance == "" || instance == s.TrellisPath() {
+		return s
+	}
+	return &service.Service{Domain: s.GetDomain(), Name: instance, Version: s.GetVersion()}
+}
+
+// Instance name of the component instance
+func Instance(name string) Option {
+	return func(p *Options) {
+		p.Instance = name
+	}
 }
 
 // Config 注入配置
@@ -78,3 +151,77 @@ func Caller(c message.Caller) Option {
 		p.Caller = c
 	}
 }
+
+// CompManager components manager for introspecting other components
+func CompManager(m Manager) Option {
+	return func(p *Options) {
+		p.CompManager = m
+	}
+}
+
+// Dependencies components which should be started before
+func Dependencies(ss ...*service.Service) Option {
+	return func(p *Options) {
+		p.Dependencies = append(p.Dependencies, ss...)
+	}
+}
+
+// StartTimeout timeout of starting component, no timeout if zero
+func StartTimeout(t time.Duration) Option {
+	return func(p *Options) {
+		p.StartTimeout = t
+	}
+}
+
+// StopTimeout timeout of stopping component, no timeout if zero
+func StopTimeout(t time.Duration) Option {
+	return func(p *Options) {
+		p.StopTimeout = t
+	}
+}
+
+// ConfigSource where the options come from
+func ConfigSource(src string) Option {
+	return func(p *Options) {
+		p.ConfigSource = src
+	}
+}
+
+// Registry name of the registry which the service is bound to
+func Registry(name string) Option {
+	return func(p *Options) {
+		p.Registry = name
+	}
+}
+
+// ProjectConfig the whole configuration of the project, for introspecting
+func ProjectConfig(c config.Config) Option {
+	return func(p *Options) {
+		p.ProjectConfig = c
+	}
+}
+
+// MessageLogger logger with the request id of the message,
+// components should use it for logging during the call,
+// the logger attached by the caller of components is returned if exists, see message.SetLogger
+func MessageLogger(l logger.Logger, msg message.Message) logger.Logger {
+	if msg == nil {
+		return l
+	}
+	if ml := message.GetLogger(msg); ml != nil {
+		return ml
+	}
+	return RequestLogger(l, msg)
+}
+
+// RequestLogger logger with the request id of the message
+func RequestLogger(l logger.Logger, msg message.Message) logger.Logger {
+	if l == nil || msg == nil {
+		return l
+	}
+	reqID := msg.GetPayload().Get(service.HeaderXRequestID)
+	if reqID == "" {
+		return l
+	}
+	return l.With("request_id", reqID)
+}
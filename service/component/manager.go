@@ -18,14 +18,33 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package component
 
 import (
+	"github.com/iTrellis/common/logger"
+
 	"github.com/iTrellis/trellis/service"
 )
 
 // Manager local router
 type Manager interface {
 	RegisterComponentFunc(service *service.Service, fn NewComponentFunc) error
-	RegisterComponent(s *service.Service, cpt Component) error
+	RegisterComponent(s *service.Service, cpt Component, opts ...Option) error
 	ListComponents() []Describe
+	// NewComponent new component instance by the service's function,
+	// the instance name is set by option Instance, default is the trellis path of the service
 	NewComponent(s *service.Service, opts ...Option) (Component, error)
+	// GetComponent get the instance by it's identity, see InstanceService
 	GetComponent(*service.Service) (Component, error)
+	// GetInstance get the component by instance name
+	GetInstance(name string) (Component, error)
+	// GetLogger get the logger of the instance by it's identity, nil if the instance has no logger
+	GetLogger(*service.Service) logger.Logger
+
+	// StartComponent start the created or stopped component instance
+	StartComponent(name string) error
+	// StopComponent stop the running component instance
+	StopComponent(name string) error
+	// RestartComponent stop the component instance, then new it again if it has function, and start it
+	RestartComponent(name string) error
+	// RemoveComponent stop and remove the component instance, it's function is kept to new it again,
+	// it's refused if running components depend on it
+	RemoveComponent(name string) error
 }
@@ -0,0 +1,184 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package component
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/iTrellis/trellis/service/message"
+)
+
+// TopicLister component which could list it's topics
+type TopicLister interface {
+	ListTopics() []Topic
+}
+
+// Topic description of topic handler
+type Topic struct {
+	Name     string `json:"name"`
+	Request  string `json:"request,omitempty"`
+	Response string `json:"response,omitempty"`
+
+	// RequestType & ResponseType are nil if the handler is not typed
+	RequestType  reflect.Type `json:"-"`
+	ResponseType reflect.Type `json:"-"`
+}
+
+// Router route the message to the handler registered by topic
+type Router struct {
+	sync.RWMutex
+
+	topics map[string]*topicHandler
+}
+
+type topicHandler struct {
+	topic   Topic
+	handler Handler
+}
+
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfMessage = reflect.TypeOf((*message.Message)(nil)).Elem()
+)
+
+// NewRouter new topic router
+func NewRouter() *Router {
+	return &Router{topics: make(map[string]*topicHandler)}
+}
+
+// Handle register the handler of the topic
+func (p *Router) Handle(topic string, h Handler, mws ...Middleware) error {
+	if h == nil {
+		return errors.New("handler is nil")
+	}
+	return p.handle(Topic{Name: topic}, h, mws...)
+}
+
+// HandleFunc register typed function of the topic, fn should be one of:
+// func(*Request) (Response, error)
+// func(message.Message, *Request) (Response, error)
+// the request is decoded by the codec of the message
+func (p *Router) HandleFunc(topic string, fn interface{}, mws ...Middleware) error {
+	h, t, err := newTypedHandler(fn)
+	if err != nil {
+		return fmt.Errorf("topic %s: %s", topic, err.Error())
+	}
+	t.Name = topic
+	return p.handle(t, h, mws...)
+}
+
+func (p *Router) handle(t Topic, h Handler, mws ...Middleware) error {
+	if t.Name == "" {
+		return errors.New("topic is empty")
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.topics[t.Name]; ok {
+		return fmt.Errorf("topic already registered: %s", t.Name)
+	}
+
+	p.topics[t.Name] = &topicHandler{topic: t, handler: Chain(h, mws...)}
+	return nil
+}
+
+// Route route the message to the handler of the message's topic
+func (p *Router) Route(msg message.Message) (interface{}, error) {
+	p.RLock()
+	th, ok := p.topics[msg.Topic()]
+	p.RUnlock()
+	if !ok {
+		return nil, message.NewError(message.ErrCodeUnknownTopic,
+			msg.Service().TrellisPath(), fmt.Sprintf("unknown topic: %s", msg.Topic()))
+	}
+	return th.handler(msg)
+}
+
+// ListTopics list all registered topics sorted by name
+func (p *Router) ListTopics() []Topic {
+	p.RLock()
+	topics := make([]Topic, 0, len(p.topics))
+	for _, th := range p.topics {
+		topics = append(topics, th.topic)
+	}
+	p.RUnlock()
+
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics
+}
+
+func newTypedHandler(fn interface{}) (Handler, Topic, error) {
+	t := Topic{}
+
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, t, fmt.Errorf("handler should be function, but got: %s", ft)
+	}
+
+	withMessage := false
+	switch ft.NumIn() {
+	case 1:
+	case 2:
+		if ft.In(0) != typeOfMessage {
+			return nil, t, fmt.Errorf("first argument should be message.Message, but got: %s", ft.In(0))
+		}
+		withMessage = true
+	default:
+		return nil, t, fmt.Errorf("handler should have 1 or 2 arguments, but got: %d", ft.NumIn())
+	}
+
+	reqType := ft.In(ft.NumIn() - 1)
+	if reqType.Kind() != reflect.Ptr {
+		return nil, t, fmt.Errorf("request should be pointer, but got: %s", reqType)
+	}
+
+	if ft.NumOut() != 2 || ft.Out(1) != typeOfError {
+		return nil, t, errors.New("handler should return (response, error)")
+	}
+
+	t.RequestType, t.ResponseType = reqType.Elem(), ft.Out(0)
+	t.Request, t.Response = t.RequestType.String(), t.ResponseType.String()
+
+	h := func(msg message.Message) (interface{}, error) {
+		req := reflect.New(reqType.Elem())
+		if len(msg.GetPayload().GetBody()) != 0 {
+			if err := msg.ToObject(req.Interface()); err != nil {
+				return nil, message.NewError(message.ErrCodeBadRequest, msg.Service().TrellisPath(),
+					fmt.Sprintf("bad request: %s", err.Error()))
+			}
+		}
+
+		var in []reflect.Value
+		if withMessage {
+			in = append(in, reflect.ValueOf(&msg).Elem())
+		}
+		out := fv.Call(append(in, req))
+
+		if err, _ := out[1].Interface().(error); err != nil {
+			return nil, err
+		}
+		return out[0].Interface(), nil
+	}
+
+	return h, t, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package component
+
+import (
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+	"github.com/iTrellis/trellis/service"
+	"github.com/iTrellis/trellis/service/message"
+)
+
+type echoReq struct {
+	Name string `json:"name"`
+}
+
+func TestRouter(t *testing.T) {
+	r := NewRouter()
+
+	testutils.Ok(t, r.Handle("plain", func(message.Message) (interface{}, error) { return "plain", nil }))
+	testutils.Ok(t, r.HandleFunc("echo", func(req *echoReq) (string, error) { return "hello " + req.Name, nil }))
+	testutils.Ok(t, r.HandleFunc("topic", func(msg message.Message, _ *echoReq) (string, error) {
+		return msg.Topic(), nil
+	}, func(next Handler) Handler {
+		return func(msg message.Message) (interface{}, error) {
+			resp, err := next(msg)
+			return resp.(string) + "!", err
+		}
+	}))
+
+	testutils.NotOk(t, r.Handle("plain", func(message.Message) (interface{}, error) { return nil, nil }))
+	testutils.NotOk(t, r.HandleFunc("bad", func(req echoReq) (string, error) { return "", nil }))
+
+	newMsg := func(topic, body string) message.Message {
+		return message.NewMessage(
+			message.Service(&service.Service{Name: "router", Version: "v1", Topic: topic}),
+			message.MessagePayload(&message.Payload{Body: []byte(body)}),
+		)
+	}
+
+	resp, err := r.Route(newMsg("plain", ""))
+	testutils.Ok(t, err)
+	testutils.Equals(t, "plain", resp)
+
+	resp, err = r.Route(newMsg("echo", `{"name":"trellis"}`))
+	testutils.Ok(t, err)
+	testutils.Equals(t, "hello trellis", resp)
+
+	resp, err = r.Route(newMsg("topic", ""))
+	testutils.Ok(t, err)
+	testutils.Equals(t, "topic!", resp)
+
+	_, err = r.Route(newMsg("unknown", ""))
+	testutils.NotOk(t, err)
+	testutils.Equals(t, message.ErrCodeUnknownTopic, err.(*message.Error).GetCode())
+
+	topics := r.ListTopics()
+	testutils.Equals(t, 3, len(topics))
+	testutils.Equals(t, "echo", topics[0].Name)
+	testutils.Equals(t, "component.echoReq", topics[0].Request)
+	testutils.Equals(t, "string", topics[0].Response)
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(msg message.Message) (interface{}, error) {
+				calls = append(calls, name+":before")
+				resp, err := next(msg)
+				calls = append(calls, name+":after")
+				return resp, err
+			}
+		}
+	}
+
+	h := Chain(func(message.Message) (interface{}, error) {
+		calls = append(calls, "handler")
+		return "ok", nil
+	}, mw("a"), mw("b"))
+
+	resp, err := h(message.NewMessage())
+	testutils.Ok(t, err)
+	testutils.Equals(t, "ok", resp)
+	testutils.Equals(t, []string{"a:before", "b:before", "handler", "b:after", "a:after"}, calls)
+}
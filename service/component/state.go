@@ -0,0 +1,52 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package component
+
+// State lifecycle state of component
+type State int32
+
+// states of component
+const (
+	StateCreated State = iota
+	StateStarting
+	StateRunning
+	StateStopping
+	StateStopped
+	StateFailed
+)
+
+var stateNames = map[State]string{
+	StateCreated:  "created",
+	StateStarting: "starting",
+	StateRunning:  "running",
+	StateStopping: "stopping",
+	StateStopped:  "stopped",
+	StateFailed:   "failed",
+}
+
+func (p State) String() string {
+	if name, ok := stateNames[p]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalText marshal state into it's name
+func (p State) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
@@ -24,7 +24,10 @@ const (
 	// headers
 	HeaderXAPI          = "X-Api"
 	HeaderXAPIToken     = "X-Api-Token"
+	HeaderXService      = "X-Service"
+	HeaderXTopic        = "X-Topic"
 	HeaderXClientIP     = "X-Client-IP"
+	HeaderXConnectionID = "X-Connection-ID"
 	HeaderXRequestID    = "X-Request-ID"
 	HeaderReferer       = "Referer"
 	HeaderContentLength = "Content-Length"
@@ -36,6 +39,11 @@ const (
 	HeaderAuthorization = "Authorization"
 	HeaderOrigin        = "Origin"
 
+	// principal authenticated by the gateway
+	HeaderXPrincipalID            = "X-Principal-ID"
+	HeaderXPrincipalAuthenticator = "X-Principal-Authenticator"
+	HeaderXPrincipalRoles         = "X-Principal-Roles"
+
 	// cors
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
 	HeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
@@ -61,6 +69,7 @@ const (
 const (
 	MIMEApplicationJSON                  = "application/json"
 	MIMEApplicationJSONCharsetUTF8       = MIMEApplicationJSON + "; " + charsetUTF8
+	MIMEApplicationProblemJSON           = "application/problem+json"
 	MIMEApplicationJavaScript            = "application/javascript"
 	MIMEApplicationJavaScriptCharsetUTF8 = MIMEApplicationJavaScript + "; " + charsetUTF8
 	MIMEApplicationXML                   = "application/xml"
@@ -76,4 +85,5 @@ const (
 	MIMETextPlainCharsetUTF8             = MIMETextPlain + "; " + charsetUTF8
 	MIMEMultipartForm                    = "multipart/form-data"
 	MIMEOctetStream                      = "application/octet-stream"
+	MIMETextEventStream                  = "text/event-stream"
 )
@@ -0,0 +1,94 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package message
+
+import (
+	"fmt"
+
+	"github.com/iTrellis/common/errors"
+)
+
+// error codes of trellis
+const (
+	ErrCodeBadRequest     uint64 = 10
+	ErrCodeAPINotFound    uint64 = 11
+	ErrCodeUnknownTopic   uint64 = 12
+	ErrCodeSimpleError    uint64 = 14
+	ErrCodeUnknownError   uint64 = 15
+	ErrCodeRemoteResponse uint64 = 16
+	ErrCodeComponentPanic uint64 = 17
+	// the request is shed by rate limits or concurrency limits
+	ErrCodeTooManyRequests uint64 = 18
+	ErrCodeUnauthorized    uint64 = 19
+	ErrCodeForbidden       uint64 = 20
+	// the response of the component doesn't match the schema of the api
+	ErrCodeInvalidResponse uint64 = 21
+	// the request body is larger than the max body size
+	ErrCodeRequestTooLarge uint64 = 22
+)
+
+// NewError new structured error
+func NewError(code uint64, namespace, msg string) *Error {
+	return &Error{
+		Code:      code,
+		Namespace: namespace,
+		Message:   msg,
+	}
+}
+
+// Error implements error interface
+func (m *Error) Error() string {
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s: (%d) %s", m.Namespace, m.Code, m.Message)
+}
+
+// SetDetail set detail information of the error
+func (m *Error) SetDetail(key, value string) *Error {
+	if m.Details == nil {
+		m.Details = make(map[string]string)
+	}
+	m.Details[key] = value
+	return m
+}
+
+// SetRetryable mark the error whether the caller could retry
+func (m *Error) SetRetryable(retryable bool) *Error {
+	m.Retryable = retryable
+	return m
+}
+
+// FromError convert error into structured error,
+// namespace is used when the err has no namespace
+func FromError(err error, namespace string) *Error {
+	if err == nil {
+		return nil
+	}
+
+	switch et := err.(type) {
+	case *Error:
+		return et
+	case errors.ErrorCode:
+		return NewError(et.Code(), et.Namespace(), et.Error())
+	case errors.SimpleError:
+		return NewError(ErrCodeSimpleError, et.Namespace(), et.Error())
+	default:
+		return NewError(ErrCodeUnknownError, namespace, et.Error())
+	}
+}
@@ -0,0 +1,37 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package message
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+)
+
+func TestFromError(t *testing.T) {
+	testutils.Assert(t, FromError(nil, "trellis") == nil, "nil error expected")
+
+	mErr := NewError(ErrCodeBadRequest, "trellis/a/v1", "bad request").SetDetail("field", "name").SetRetryable(true)
+	testutils.Assert(t, FromError(mErr, "trellis") == mErr, "structured error should be kept")
+
+	err := FromError(errors.New("boom"), "trellis")
+	testutils.Equals(t, ErrCodeUnknownError, err.GetCode())
+	testutils.Equals(t, "trellis", err.GetNamespace())
+	testutils.Equals(t, "boom", err.GetMessage())
+}
@@ -19,8 +19,11 @@ package message
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
+	"github.com/iTrellis/common/logger"
+
 	"github.com/iTrellis/trellis/service"
 	"github.com/iTrellis/trellis/service/codec"
 	"github.com/iTrellis/trellis/service/codec/json"
@@ -43,6 +46,10 @@ type local struct {
 	service *service.Service
 
 	payload *Payload
+	reader  io.Reader
+
+	// logger of the call, see SetLogger
+	logger logger.Logger
 
 	codec codec.Codec
 }
@@ -56,6 +63,7 @@ func NewMessage(opts ...Option) Message {
 	m := &local{
 		service: options.Service,
 		payload: options.Payload,
+		reader:  options.BodyReader,
 	}
 
 	return m
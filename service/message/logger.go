@@ -0,0 +1,38 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package message
+
+import (
+	"github.com/iTrellis/common/logger"
+)
+
+// SetLogger attach the logger of the call to the message, which is set by the caller of components,
+// such as the logger of the called component with the request id
+func SetLogger(msg Message, l logger.Logger) {
+	if m, ok := msg.(*local); ok {
+		m.logger = l
+	}
+}
+
+// GetLogger the logger attached to the message, nil if no logger is attached
+func GetLogger(msg Message) logger.Logger {
+	if m, ok := msg.(*local); ok {
+		return m.logger
+	}
+	return nil
+}
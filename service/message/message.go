@@ -51,6 +51,22 @@ func (p *RemoteMessage) ToMessage() Message {
 		Service(p.Service))
 }
 
+// prefixes of the payload header keys mapped from http requests
+const (
+	PathParamPrefix  = "Path-Param-"
+	QueryParamPrefix = "Query-Param-"
+)
+
+// PathParam get the path param of the http route, such as id of /users/:id
+func (p *Payload) PathParam(name string) string {
+	return p.Get(PathParamPrefix + name)
+}
+
+// QueryParam get the query param of the http request, multiple values are joined by comma
+func (p *Payload) QueryParam(name string) string {
+	return p.Get(QueryParamPrefix + name)
+}
+
 func (p *Payload) Set(key, value string) {
 	header := p.GetHeader()
 	if header == nil {
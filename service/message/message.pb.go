@@ -87,6 +87,7 @@ func (m *Request) GetPayload() *Payload {
 type Response struct {
 	Body                 []byte            `protobuf:"bytes,1,opt,name=body,proto3" json:"body,omitempty"`
 	Header               map[string]string `protobuf:"bytes,2,rep,name=header,proto3" json:"header,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Error                *Error            `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
 	XXX_unrecognized     []byte            `json:"-"`
 	XXX_sizecache        int32             `json:"-"`
@@ -131,6 +132,13 @@ func (m *Response) GetHeader() map[string]string {
 	return nil
 }
 
+func (m *Response) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
 type Payload struct {
 	Header               map[string]string `protobuf:"bytes,2,rep,name=header,proto3" json:"header,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 	Body                 []byte            `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
@@ -178,35 +186,114 @@ func (m *Payload) GetBody() []byte {
 	return nil
 }
 
+type Error struct {
+	Code                 uint64            `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Namespace            string            `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Message              string            `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Details              map[string]string `protobuf:"bytes,4,rep,name=details,proto3" json:"details,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Retryable            bool              `protobuf:"varint,5,opt,name=retryable,proto3" json:"retryable,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *Error) Reset()         { *m = Error{} }
+func (m *Error) String() string { return proto.CompactTextString(m) }
+func (*Error) ProtoMessage()    {}
+func (*Error) Descriptor() ([]byte, []int) {
+	return fileDescriptor_33c57e4bae7b9afd, []int{3}
+}
+
+func (m *Error) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Error.Unmarshal(m, b)
+}
+func (m *Error) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Error.Marshal(b, m, deterministic)
+}
+func (m *Error) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Error.Merge(m, src)
+}
+func (m *Error) XXX_Size() int {
+	return xxx_messageInfo_Error.Size(m)
+}
+func (m *Error) XXX_DiscardUnknown() {
+	xxx_messageInfo_Error.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Error proto.InternalMessageInfo
+
+func (m *Error) GetCode() uint64 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *Error) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *Error) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Error) GetDetails() map[string]string {
+	if m != nil {
+		return m.Details
+	}
+	return nil
+}
+
+func (m *Error) GetRetryable() bool {
+	if m != nil {
+		return m.Retryable
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*Request)(nil), "message.Request")
 	proto.RegisterType((*Response)(nil), "message.Response")
 	proto.RegisterMapType((map[string]string)(nil), "message.Response.HeaderEntry")
 	proto.RegisterType((*Payload)(nil), "message.Payload")
 	proto.RegisterMapType((map[string]string)(nil), "message.Payload.HeaderEntry")
+	proto.RegisterType((*Error)(nil), "message.Error")
+	proto.RegisterMapType((map[string]string)(nil), "message.Error.DetailsEntry")
 }
 
 func init() { proto.RegisterFile("message.proto", fileDescriptor_33c57e4bae7b9afd) }
 
 var fileDescriptor_33c57e4bae7b9afd = []byte{
-	// 299 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x51, 0x4f, 0x4b, 0xfb, 0x40,
-	0x10, 0x65, 0x93, 0xfe, 0x9a, 0x76, 0xf2, 0xab, 0x94, 0xc5, 0x43, 0x08, 0x0a, 0x21, 0xa7, 0xe0,
-	0x21, 0x81, 0xd6, 0x82, 0x7f, 0x6e, 0x82, 0xe0, 0x51, 0x56, 0x4f, 0xde, 0x92, 0xee, 0xd0, 0x2e,
-	0xa6, 0xd9, 0x98, 0xdd, 0x14, 0xf2, 0x21, 0x14, 0x3f, 0xb2, 0x34, 0xd9, 0x44, 0x29, 0xde, 0x3c,
-	0xcd, 0xce, 0xdb, 0x37, 0x6f, 0xde, 0x63, 0x60, 0xb6, 0x43, 0xa5, 0xd2, 0x0d, 0xc6, 0x65, 0x25,
-	0xb5, 0xa4, 0x8e, 0x69, 0xfd, 0x99, 0xc2, 0x6a, 0x2f, 0xd6, 0x06, 0x0f, 0xdf, 0x09, 0x38, 0x0c,
-	0xdf, 0x6a, 0x54, 0x9a, 0x9e, 0x80, 0x25, 0xb8, 0x47, 0x02, 0x12, 0x4d, 0x99, 0x25, 0x38, 0xbd,
-	0x00, 0xc7, 0x90, 0x3d, 0x2b, 0x20, 0x91, 0xbb, 0x98, 0xc7, 0xfd, 0xf0, 0x53, 0x57, 0x59, 0x4f,
-	0xa0, 0x3e, 0x4c, 0xb0, 0xe0, 0xa5, 0x14, 0x85, 0xf6, 0xec, 0x56, 0x61, 0xe8, 0x0f, 0x3a, 0x65,
-	0xda, 0xe4, 0x32, 0xe5, 0xde, 0xc8, 0xe8, 0xf4, 0xe6, 0x1e, 0x3b, 0x9c, 0xf5, 0x84, 0xf0, 0x93,
-	0xc0, 0x84, 0xa1, 0x2a, 0x65, 0xa1, 0x90, 0x52, 0x18, 0x65, 0x92, 0x37, 0xad, 0xa5, 0xff, 0xac,
-	0x7d, 0xd3, 0x15, 0x8c, 0xb7, 0x98, 0x72, 0xac, 0x3c, 0x2b, 0xb0, 0x23, 0x77, 0x71, 0x3e, 0x68,
-	0xf5, 0x63, 0xf1, 0x43, 0xfb, 0x7f, 0x5f, 0xe8, 0xaa, 0x61, 0x86, 0xec, 0x5f, 0x83, 0xfb, 0x03,
-	0xa6, 0x73, 0xb0, 0x5f, 0xb1, 0x31, 0x59, 0x0f, 0x4f, 0x7a, 0x0a, 0xff, 0xf6, 0x69, 0x5e, 0x77,
-	0x51, 0xa7, 0xac, 0x6b, 0x6e, 0xac, 0x2b, 0x12, 0x7e, 0x10, 0x70, 0x8c, 0x4f, 0x7a, 0x79, 0xb4,
-	0xfd, 0xec, 0x38, 0xc9, 0x6f, 0xcb, 0x87, 0x1c, 0xf6, 0x77, 0x8e, 0x3f, 0x18, 0xba, 0x5b, 0xbd,
-	0x2c, 0x37, 0x42, 0x6f, 0xeb, 0x2c, 0x5e, 0xcb, 0x5d, 0x22, 0x9e, 0x2b, 0xcc, 0x73, 0xa1, 0x12,
-	0x6d, 0xaa, 0x39, 0x49, 0x62, 0x9c, 0xdd, 0x9a, 0x9a, 0x8d, 0xdb, 0x8b, 0x2f, 0xbf, 0x02, 0x00,
-	0x00, 0xff, 0xff, 0x1a, 0xa3, 0x89, 0x61, 0x1a, 0x02, 0x00, 0x00,
+	// 400 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x52, 0x4f, 0x6f, 0xd3, 0x30,
+	0x14, 0x97, 0xd3, 0x76, 0x69, 0x5f, 0xb7, 0x69, 0xb2, 0x38, 0x58, 0x61, 0x48, 0x51, 0xc5, 0x21,
+	0xe2, 0x90, 0x4a, 0x1d, 0x95, 0x60, 0xdc, 0x10, 0x93, 0x38, 0x22, 0xc3, 0x89, 0x9b, 0x13, 0x3f,
+	0x6d, 0x16, 0x69, 0x1c, 0x6c, 0x77, 0x52, 0x3e, 0x04, 0x7c, 0x1c, 0x3e, 0x11, 0x1f, 0x04, 0xc5,
+	0xb1, 0xdb, 0x31, 0x71, 0x41, 0x3b, 0xf9, 0xfd, 0xfb, 0xfd, 0xf2, 0xfb, 0xbd, 0x3c, 0x38, 0xdb,
+	0xa1, 0xb5, 0xe2, 0x16, 0xcb, 0xce, 0x68, 0xa7, 0x69, 0x1a, 0xd2, 0xec, 0xcc, 0xa2, 0xb9, 0x57,
+	0x75, 0xa8, 0xaf, 0x7e, 0x10, 0x48, 0x39, 0x7e, 0xdf, 0xa3, 0x75, 0xf4, 0x1c, 0x12, 0x25, 0x19,
+	0xc9, 0x49, 0xb1, 0xe0, 0x89, 0x92, 0xf4, 0x15, 0xa4, 0x61, 0x98, 0x25, 0x39, 0x29, 0x96, 0x9b,
+	0x8b, 0x32, 0x82, 0x3f, 0x8f, 0x2f, 0x8f, 0x03, 0x34, 0x83, 0x39, 0xb6, 0xb2, 0xd3, 0xaa, 0x75,
+	0x6c, 0xe2, 0x19, 0x0e, 0xf9, 0xc0, 0xd3, 0x89, 0xbe, 0xd1, 0x42, 0xb2, 0x69, 0xe0, 0x89, 0xe2,
+	0x3e, 0x8d, 0x75, 0x1e, 0x07, 0x56, 0xbf, 0x08, 0xcc, 0x39, 0xda, 0x4e, 0xb7, 0x16, 0x29, 0x85,
+	0x69, 0xa5, 0x65, 0xef, 0x25, 0x9d, 0x72, 0x1f, 0xd3, 0x2d, 0x9c, 0xdc, 0xa1, 0x90, 0x68, 0x58,
+	0x92, 0x4f, 0x8a, 0xe5, 0xe6, 0xc5, 0x81, 0x2b, 0xc2, 0xca, 0x8f, 0xbe, 0x7f, 0xd3, 0x3a, 0xd3,
+	0xf3, 0x30, 0x4c, 0x5f, 0xc2, 0x0c, 0x8d, 0xd1, 0xc6, 0x8b, 0x5b, 0x6e, 0xce, 0x0f, 0xa8, 0x9b,
+	0xa1, 0xca, 0xc7, 0x66, 0xf6, 0x16, 0x96, 0x0f, 0xc0, 0xf4, 0x02, 0x26, 0xdf, 0xb0, 0x0f, 0x1b,
+	0x19, 0x42, 0xfa, 0x0c, 0x66, 0xf7, 0xa2, 0xd9, 0x8f, 0x0b, 0x59, 0xf0, 0x31, 0xb9, 0x4e, 0xde,
+	0x90, 0xd5, 0x4f, 0x02, 0x69, 0x70, 0x43, 0x5f, 0x3f, 0xd2, 0x78, 0xf9, 0xd8, 0xef, 0x3f, 0x25,
+	0x46, 0xb7, 0x93, 0xa3, 0xdb, 0xa7, 0x08, 0xfa, 0x4d, 0x60, 0xe6, 0xcd, 0x0d, 0xc4, 0xb5, 0x96,
+	0xe8, 0x61, 0x53, 0xee, 0x63, 0x7a, 0x09, 0x8b, 0x56, 0xec, 0xd0, 0x76, 0xa2, 0x8e, 0xd8, 0x63,
+	0x81, 0x32, 0x88, 0xf7, 0x12, 0x7e, 0x66, 0x4c, 0xe9, 0x16, 0x52, 0x89, 0x4e, 0xa8, 0xc6, 0xb2,
+	0xa9, 0xf7, 0xf6, 0xfc, 0xef, 0x4d, 0x96, 0x1f, 0xc6, 0xee, 0x68, 0x2d, 0xce, 0x0e, 0x9f, 0x33,
+	0xe8, 0x4c, 0x2f, 0xaa, 0x06, 0xd9, 0x2c, 0x27, 0xc5, 0x9c, 0x1f, 0x0b, 0xd9, 0x35, 0x9c, 0x3e,
+	0x84, 0xfd, 0x8f, 0xcd, 0xf7, 0xdb, 0xaf, 0x57, 0xb7, 0xca, 0xdd, 0xed, 0xab, 0xb2, 0xd6, 0xbb,
+	0xb5, 0xfa, 0x62, 0xb0, 0x69, 0x94, 0x5d, 0xbb, 0xf0, 0x86, 0xfb, 0x5c, 0x07, 0x91, 0xef, 0xc2,
+	0x5b, 0x9d, 0xf8, 0xf3, 0xbf, 0xfa, 0x33, 0x00, 0x51, 0x46, 0xd7, 0xa9, 0x27, 0x03, 0x00, 0x00,
 }
@@ -18,6 +18,8 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package message
 
 import (
+	"io"
+
 	service "github.com/iTrellis/trellis/service"
 )
 
@@ -29,6 +31,9 @@ type Options struct {
 	Service *service.Service
 
 	Payload *Payload
+
+	// BodyReader the streamed body, see GetBodyReader
+	BodyReader io.Reader
 }
 
 func MessagePayload(payload *Payload) Option {
@@ -37,6 +42,13 @@ func MessagePayload(payload *Payload) Option {
 	}
 }
 
+// BodyReader the body of the message is streamed by the reader rather than the payload
+func BodyReader(r io.Reader) Option {
+	return func(o *Options) {
+		o.BodyReader = r
+	}
+}
+
 func Service(s *service.Service) Option {
 	return func(o *Options) {
 		o.Service = s
@@ -0,0 +1,88 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+
+	"github.com/iTrellis/trellis/service"
+)
+
+// GetBodyReader the reader of the message body, which is the streamed body,
+// or the body of the payload if the message is not streamed
+func GetBodyReader(msg Message) io.Reader {
+	if l, ok := msg.(*local); ok && l.reader != nil {
+		return l.reader
+	}
+	return bytes.NewReader(msg.GetPayload().GetBody())
+}
+
+// IsStreamed whether the body of the message is streamed
+func IsStreamed(msg Message) bool {
+	l, ok := msg.(*local)
+	return ok && l.reader != nil
+}
+
+// SizeLimiter the streamed body whose size is limited, such as the request body limited by the gateway
+type SizeLimiter interface {
+	// SizeLimit max size of the body, no limit if it's not positive
+	SizeLimit() int64
+}
+
+// BufferBody read the streamed body into the payload, such as the message is called by the remote servers,
+// the body is refused if it's size is not limited, so that the whole upload is never read into memory unbounded
+func BufferBody(msg Message) error {
+	l, ok := msg.(*local)
+	if !ok || l.reader == nil {
+		return nil
+	}
+
+	if sl, ok := l.reader.(SizeLimiter); !ok || sl.SizeLimit() <= 0 {
+		return NewError(ErrCodeRequestTooLarge, msg.Service().TrellisPath(),
+			"streamed body without size limit could not be buffered, set max_body_size")
+	}
+
+	body, err := ioutil.ReadAll(l.reader)
+	if err != nil {
+		return err
+	}
+	if l.payload == nil {
+		l.payload = &Payload{}
+	}
+	l.payload.Body, l.reader = body, nil
+	return nil
+}
+
+// MultipartReader the reader of the multipart body, whose boundary is in the Content-Type header of the payload
+func MultipartReader(msg Message) (*multipart.Reader, error) {
+	mediaType, params, err := mime.ParseMediaType(msg.GetPayload().Get(service.HeaderContentType))
+	if err != nil {
+		return nil, err
+	}
+	boundary := params["boundary"]
+	if !strings.HasPrefix(mediaType, "multipart/") || boundary == "" {
+		return nil, fmt.Errorf("not multipart body: %s", mediaType)
+	}
+	return multipart.NewReader(GetBodyReader(msg), boundary), nil
+}
@@ -31,6 +31,9 @@ type Option func(*Options)
 
 // Options new registry Options
 type Options struct {
+	// Name of the registry in the project
+	Name string
+
 	Endpoints []string
 	Timeout   time.Duration
 	Secure    bool
@@ -52,6 +55,12 @@ func Logger(l logger.Logger) Option {
 	}
 }
 
+func Name(name string) Option {
+	return func(o *Options) {
+		o.Name = name
+	}
+}
+
 func Endpoints(endpoints []string) Option {
 	return func(o *Options) {
 		o.Endpoints = endpoints
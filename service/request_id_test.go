@@ -0,0 +1,35 @@
+/*
+Copyright © 2020 Henry Huang <hhh@rutcode.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iTrellis/common/testutils"
+)
+
+func TestValidRequestID(t *testing.T) {
+	testutils.Equals(t, true, ValidRequestID("3f1b2c4e-5d6a-7b8c-9d0e-1f2a3b4c5d6e"))
+	testutils.Equals(t, true, ValidRequestID("lb:1234_abc.def"))
+	testutils.Equals(t, false, ValidRequestID(""))
+	testutils.Equals(t, false, ValidRequestID("id with space"))
+	testutils.Equals(t, false, ValidRequestID("id\r\nX-Injected: 1"))
+	testutils.Equals(t, true, ValidRequestID(strings.Repeat("a", MaxRequestIDLength)))
+	testutils.Equals(t, false, ValidRequestID(strings.Repeat("a", MaxRequestIDLength+1)))
+}